@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// alertsOptions are the options of the alerts command.
+type alertsOptions struct {
+	log               *logOptions
+	target            string
+	conditions        []string
+	database          string
+	retentionPolicy   string
+	bucket            string
+	orgID             string
+	datasource        string
+	measurement       string
+	suiteMeasurement  string
+	runMeasurement    string
+	branch            string
+	window            string
+	passRateThreshold float64
+	durationThreshold time.Duration
+	output            string
+}
+
+func addAlertsFlags(fs *pflag.FlagSet) *alertsOptions {
+	o := &alertsOptions{log: addLogFlags(fs)}
+	fs.StringVar(&o.target, "target", "kapacitor", "system to write the alerts for (kapacitor, influxdb, grafana)")
+	fs.StringSliceVar(&o.conditions, "condition", []string{"pass-rate", "flaky", "duration"}, "conditions to alert on (pass-rate, flaky, duration)")
+	fs.StringVarP(&o.database, "database", "d", "", "influxdb database of the points")
+	fs.StringVarP(&o.retentionPolicy, "retention-policy", "r", "", "influxdb retention policy of the points")
+	fs.StringVar(&o.bucket, "bucket", "", "bucket of the points for influxdb checks; defaults to database/retention-policy")
+	fs.StringVar(&o.orgID, "org-id", "", "id of the influxdb organization of the checks")
+	fs.StringVar(&o.datasource, "grafana-datasource", "", "uid of the influxdb datasource of the grafana alert rules")
+	fs.StringVarP(&o.measurement, "measurement", "m", "junit_test_results", "measurement of the testcase points")
+	fs.StringVar(&o.suiteMeasurement, "suite-measurement", "junit_suite_results", "measurement of the testsuite summaries")
+	fs.StringVar(&o.runMeasurement, "run-measurement", "junit_run", "measurement of the run summaries")
+	fs.StringVar(&o.branch, "branch", "main", "branch the flaky alert watches for failures")
+	fs.StringVar(&o.window, "window", "1h", "how often the alerts are checked and how far back they look, such as 15m or 1d")
+	fs.Float64Var(&o.passRateThreshold, "pass-rate-threshold", 0.98, "alert when the mean pass rate of the runs is below this")
+	fs.DurationVar(&o.durationThreshold, "duration-threshold", 10*time.Minute, "alert when a testsuite takes longer than this")
+	fs.StringVarP(&o.output, "output", "o", "", "write the alerts to this file instead of stdout")
+	return o
+}
+
+// alertCondition is a condition that an alert checks for. The value of the
+// aggregate function of the field is compared with the threshold for each
+// group of the tags.
+type alertCondition struct {
+	name        string
+	message     string
+	measurement string
+	field       string
+	fn          string
+	tags        []string
+	where       [][2]string
+	below       bool
+	threshold   float64
+}
+
+// alertConditions returns the conditions selected by the options.
+func (o *alertsOptions) alertConditions() []alertCondition {
+	var conds []alertCondition
+	for _, name := range o.conditions {
+		switch name {
+		case "pass-rate":
+			conds = append(conds, alertCondition{
+				name:        "junit_pass_rate",
+				message:     fmt.Sprintf("The pass rate of the test runs dropped below %g", o.passRateThreshold),
+				measurement: o.runMeasurement,
+				field:       "pass_rate",
+				fn:          "mean",
+				below:       true,
+				threshold:   o.passRateThreshold,
+			})
+		case "flaky":
+			// The branch only has code that passed its tests before it
+			// was merged, so a failure there is most likely flaky. This
+			// needs the status tag of --status-as tag or --schema v2.
+			conds = append(conds, alertCondition{
+				name:        "junit_flaky_test",
+				message:     fmt.Sprintf("A test failed on %s and may be flaky", o.branch),
+				measurement: o.measurement,
+				field:       "duration",
+				fn:          "count",
+				tags:        []string{"suite_name", "test_name"},
+				where:       [][2]string{{"branch", o.branch}, {"status", "failed"}},
+				threshold:   0,
+			})
+		case "duration":
+			conds = append(conds, alertCondition{
+				name:        "junit_suite_duration",
+				message:     fmt.Sprintf("A testsuite took longer than %s", o.durationThreshold),
+				measurement: o.suiteMeasurement,
+				field:       "duration",
+				fn:          "max",
+				tags:        []string{"suite_name"},
+				threshold:   o.durationThreshold.Seconds(),
+			})
+		default:
+			logger.Exitf(exitUsage, "Invalid --condition value: %s", name)
+		}
+	}
+	return conds
+}
+
+// alerts writes the alert definitions for the conditions in the format of
+// the target: a TICKscript for each condition for kapacitor, a json array of
+// threshold checks for the influxdb api, or a grafana alert rule
+// provisioning file. The durations are expected in seconds.
+func alerts(args []string) {
+	fs := pflag.NewFlagSet("alerts", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "alerts [options]")
+	o := addAlertsFlags(fs)
+	fs.Parse(args)
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+	if o.database == "" && o.bucket == "" {
+		logger.Exitf(exitUsage, "Must specify a database")
+	} else if !influxDurationRE.MatchString(o.window) || influxDurationSeconds(o.window) == 0 {
+		logger.Exitf(exitUsage, "Invalid --window value: %s", o.window)
+	}
+	conds := o.alertConditions()
+
+	var write func(w io.Writer, conds []alertCondition) error
+	switch o.target {
+	case "kapacitor":
+		write = o.writeTICKscripts
+	case "influxdb":
+		if o.orgID == "" {
+			logger.Exitf(exitUsage, "Must specify the organization of the checks with --org-id")
+		}
+		write = o.writeInfluxDBChecks
+	case "grafana":
+		if o.datasource == "" {
+			logger.Exitf(exitUsage, "Must specify the datasource of the alert rules with --grafana-datasource")
+		}
+		write = o.writeGrafanaRules
+	default:
+		logger.Exitf(exitUsage, "Invalid --target value: %s", o.target)
+	}
+
+	w := io.Writer(os.Stdout)
+	if o.output != "" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			logger.Fatalf("Unable to create output: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, conds); err != nil {
+		logger.Fatalf("Could not write the alerts: %s", err)
+	}
+}
+
+// influxQL returns the query of the condition. The time filter is left out
+// when it is empty since kapacitor adds the period of the batch itself.
+func (o *alertsOptions) influxQL(c alertCondition, timeFilter string) string {
+	conds := []string{}
+	if timeFilter != "" {
+		conds = append(conds, timeFilter)
+	}
+	for _, kv := range c.where {
+		conds = append(conds, quoteIdent(kv[0])+" = "+quoteString(kv[1]))
+	}
+	stmt := fmt.Sprintf(`SELECT %s(%s) AS "value" FROM %s`, c.fn, quoteIdent(c.field), qualifiedMeasurement(o.database, o.retentionPolicy, c.measurement))
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(c.tags) > 0 {
+		var tags []string
+		for _, tag := range c.tags {
+			tags = append(tags, quoteIdent(tag))
+		}
+		stmt += " GROUP BY " + strings.Join(tags, ", ")
+	}
+	return stmt
+}
+
+func (o *alertsOptions) writeTICKscripts(w io.Writer, conds []alertCondition) error {
+	var buf strings.Builder
+	for i, c := range conds {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		op := ">"
+		if c.below {
+			op = "<"
+		}
+		fmt.Fprintf(&buf, "// %s.tick\n", c.name)
+		fmt.Fprintf(&buf, "dbrp %s.%s\n\n", quoteIdent(o.database), quoteIdent(o.rp()))
+		fmt.Fprintf(&buf, "batch\n    |query('%s')\n", strings.Replace(o.influxQL(c, ""), "'", `\'`, -1))
+		fmt.Fprintf(&buf, "        .period(%s)\n        .every(%s)\n", o.window, o.window)
+		buf.WriteString("    |alert()\n")
+		fmt.Fprintf(&buf, "        .id('%s/{{ .Group }}')\n", c.name)
+		fmt.Fprintf(&buf, "        .message('%s: {{ index .Fields \"value\" }} {{ .Tags }}')\n", c.message)
+		fmt.Fprintf(&buf, "        .crit(lambda: \"value\" %s %g)\n", op, c.threshold)
+		buf.WriteString("        .stateChangesOnly()\n")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// rp returns the retention policy for the dbrp of a TICKscript.
+func (o *alertsOptions) rp() string {
+	if o.retentionPolicy == "" {
+		return "autogen"
+	}
+	return o.retentionPolicy
+}
+
+func (o *alertsOptions) writeInfluxDBChecks(w io.Writer, conds []alertCondition) error {
+	bucket := o.bucket
+	if bucket == "" {
+		bucket = o.database + "/" + o.rp()
+	}
+	every := o.window
+	var checks []interface{}
+	for _, c := range conds {
+		var flux strings.Builder
+		fmt.Fprintf(&flux, "from(bucket: %s)\n", fluxString(bucket))
+		flux.WriteString("    |> range(start: v.timeRangeStart, stop: v.timeRangeStop)\n")
+		fmt.Fprintf(&flux, "    |> filter(fn: (r) => r._measurement == %s and r._field == %s)\n", fluxString(c.measurement), fluxString(c.field))
+		for _, kv := range c.where {
+			fmt.Fprintf(&flux, "    |> filter(fn: (r) => r[%s] == %s)\n", fluxString(kv[0]), fluxString(kv[1]))
+		}
+		var columns []string
+		for _, tag := range c.tags {
+			columns = append(columns, fluxString(tag))
+		}
+		fmt.Fprintf(&flux, "    |> group(columns: [%s])\n", strings.Join(columns, ", "))
+		fmt.Fprintf(&flux, "    |> aggregateWindow(every: %s, fn: %s, createEmpty: false)\n", every, c.fn)
+
+		threshold := map[string]interface{}{"type": "greater", "value": c.threshold, "level": "CRIT", "allValues": false}
+		if c.below {
+			threshold["type"] = "lesser"
+		}
+		checks = append(checks, map[string]interface{}{
+			"name":                  c.name,
+			"orgID":                 o.orgID,
+			"type":                  "threshold",
+			"status":                "active",
+			"every":                 every,
+			"offset":                "0s",
+			"query":                 map[string]interface{}{"text": flux.String(), "editMode": "advanced"},
+			"statusMessageTemplate": c.message + ": ${r._value} ${r._source_measurement}",
+			"thresholds":            []interface{}{threshold},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(checks)
+}
+
+func (o *alertsOptions) writeGrafanaRules(w io.Writer, conds []alertCondition) error {
+	seconds := influxDurationSeconds(o.window)
+	var buf strings.Builder
+	buf.WriteString("apiVersion: 1\ngroups:\n")
+	buf.WriteString("  - orgId: 1\n    name: influx-junit\n    folder: Tests\n")
+	fmt.Fprintf(&buf, "    interval: %s\n    rules:\n", o.window)
+	for _, c := range conds {
+		op := "gt"
+		if c.below {
+			op = "lt"
+		}
+		fmt.Fprintf(&buf, "      - uid: %s\n        title: %s\n        condition: C\n        data:\n", c.name, yamlQuote(c.message))
+		fmt.Fprintf(&buf, "          - refId: A\n            relativeTimeRange:\n              from: %d\n              to: 0\n", seconds)
+		fmt.Fprintf(&buf, "            datasourceUid: %s\n", yamlQuote(o.datasource))
+		fmt.Fprintf(&buf, "            model:\n              refId: A\n              rawQuery: true\n              resultFormat: table\n              query: %s\n", yamlQuote(o.influxQL(c, "$timeFilter")))
+		buf.WriteString("          - refId: B\n            datasourceUid: __expr__\n            model:\n              refId: B\n              type: reduce\n              expression: A\n              reducer: last\n")
+		fmt.Fprintf(&buf, "          - refId: C\n            datasourceUid: __expr__\n            model:\n              refId: C\n              type: threshold\n              expression: B\n              conditions:\n                - evaluator:\n                    type: %s\n                    params: [%g]\n", op, c.threshold)
+		buf.WriteString("        noDataState: OK\n        execErrState: Error\n        for: 0s\n")
+		fmt.Fprintf(&buf, "        annotations:\n          summary: %s\n", yamlQuote(c.message))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// yamlQuote quotes a string for yaml. A json string is a valid yaml string.
+func yamlQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// influxDurationSeconds returns the number of seconds in a duration matched
+// by influxDurationRE.
+func influxDurationSeconds(s string) int64 {
+	units := map[byte]int64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	n, _ := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	return n * units[s[len(s)-1]]
+}
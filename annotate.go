@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// runStatus returns passed when none of the testcases in the run failed and
+// failed otherwise.
+func (c *converter) runStatus() string {
+	if c.run.failures+c.run.errors > 0 {
+		return "failed"
+	}
+	return "passed"
+}
+
+// runText describes the totals of the run.
+func (c *converter) runText() string {
+	return fmt.Sprintf("%d tests, %d failures, %d errors, %d skipped", c.run.tests, c.run.failures, c.run.errors, c.run.skipped)
+}
+
+// writeRunAnnotation writes a point with a title and text for the run that
+// can be used as the annotation query of a grafana dashboard.
+func (c *converter) writeRunAnnotation(pw PointsWriter, measurement string, now time.Time) error {
+	status := c.runStatus()
+	tags := map[string]string{"status": status}
+	fields := map[string]interface{}{
+		"title": "Test run " + status,
+		"text":  c.runText(),
+	}
+	return c.writePoint(pw, measurement, newTemplateData(nil, nil), tags, fields, now)
+}
+
+// postGrafanaAnnotation creates an annotation for the run with the grafana
+// http api. The annotation is tagged with the status of the run and the
+// branch and build number when they are known.
+func (c *converter) postGrafanaAnnotation(client *http.Client, grafanaURL, token, link string, now time.Time) error {
+	tags := []string{"junit", c.runStatus()}
+	for _, k := range []string{"branch", "build_number"} {
+		if v := c.tags[k]; v != "" {
+			tags = append(tags, k+":"+v)
+		}
+	}
+	text := "Test run " + c.runStatus() + ": " + c.runText()
+	if link != "" {
+		text += fmt.Sprintf(` <a href="%s">results</a>`, link)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"time": now.UnixNano() / int64(time.Millisecond),
+		"tags": tags,
+		"text": text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(grafanaURL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grafana returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
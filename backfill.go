@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// backfillOptions are the options of the backfill command in addition to
+// the ingest options.
+type backfillOptions struct {
+	pattern    string
+	pathLayout string
+	rateLimit  string
+}
+
+func addBackfillFlags(fs *pflag.FlagSet) *backfillOptions {
+	o := &backfillOptions{}
+	fs.StringVar(&o.pattern, "pattern", "*.xml", "glob matching the base names of the reports within the directory")
+	fs.StringVar(&o.pathLayout, "path-time-layout", "2006-01-02", "go time layout of the directory names that hold the date of the reports within them")
+	fs.StringVar(&o.rateLimit, "rate-limit", "", "write at most this many reports per second, minute, or hour, such as 10/s")
+	return o
+}
+
+// backfill writes the points for an archive of old reports with the time
+// each report was written instead of the current time. The testsuites are
+// placed at their timestamp attribute. A report whose testsuites have no
+// timestamp is placed at the time of the closest directory above it with a
+// name matching --path-time-layout, such as reports/2024-06-01/unit.xml,
+// and otherwise at its modification time. The run summary is not written
+// since the reports come from many runs.
+func backfill(args []string) {
+	fs := pflag.NewFlagSet("backfill", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "backfill [options] <dir>")
+	o := newIngestOptions(fs)
+	bo := addBackfillFlags(fs)
+	// The testsuites are placed at their timestamps by default.
+	if f := fs.Lookup("time-source"); f != nil {
+		f.DefValue = "timeline"
+		f.Value.Set(f.DefValue)
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		logger.Exitf(exitUsage, "Must specify the directory of the reports")
+	}
+	dir := fs.Arg(0)
+	if _, err := filepath.Match(bo.pattern, ""); err != nil {
+		logger.Exitf(exitUsage, "Invalid --pattern value: %s", err)
+	}
+	var limiter *rateLimiter
+	if bo.rateLimit != "" {
+		n, per, err := parseRateLimit(bo.rateLimit)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --rate-limit value: %s", err)
+		}
+		// A burst of one spreads the reports evenly over the interval.
+		limiter = newRateLimiter(n, per)
+		limiter.burst = 1
+	}
+
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ok, _ := filepath.Match(bo.pattern, fi.Name()); ok && !fi.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Exitf(exitUsage, "Unable to read %s: %s", dir, err)
+	} else if len(files) == 0 {
+		logger.Exitf(exitUsage, "No reports in %s match %s", dir, bo.pattern)
+	}
+
+	c, precision := newIngestConverter(fs, o, nil)
+	if *o.runSummary {
+		logger.Warnf("The run summary is not written by backfill")
+	}
+	pw, _, _ := newIngestWriter(o, c, precision)
+
+	var (
+		buf                           bufferedPointsWriter
+		written, parseErrs, writeErrs int
+		seriesLimit                   error
+	)
+	for _, path := range files {
+		if limiter != nil {
+			for {
+				ok, wait := limiter.allow("", time.Now())
+				if ok {
+					break
+				}
+				time.Sleep(wait)
+			}
+		}
+		if err := ingestFile(c, pw, &buf, path, reportTime(path, dir, bo.pathLayout)); err != nil {
+			if exitCode(err) == exitSeriesLimit {
+				seriesLimit = err
+				break
+			} else if exitCode(err) == exitParse {
+				parseErrs++
+			} else {
+				writeErrs++
+			}
+			logger.Errorf("%s", err)
+			if *o.failFast {
+				break
+			}
+			continue
+		}
+		written++
+	}
+
+	if closer, ok := pw.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Fatalf("Could not close output: %s", err)
+		}
+	}
+	logger.Info("Backfilled reports", "written", written, "failed", parseErrs+writeErrs)
+	if seriesLimit != nil {
+		logger.Exitf(exitSeriesLimit, "%s", seriesLimit)
+	}
+
+	if failed := parseErrs + writeErrs; failed > 0 {
+		code := exitParse
+		if writeErrs > 0 {
+			code = exitPartialWrite
+			if written == 0 {
+				code = exitConnection
+			}
+		}
+		logger.Exitf(code, "Could not write %d of %d reports", failed, len(files))
+	}
+}
+
+// reportTime returns the time of a report from the name of the closest
+// directory above it within root that matches the layout, or otherwise
+// from its modification time.
+func reportTime(path, root, layout string) time.Time {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if t, err := time.Parse(layout, filepath.Base(dir)); err == nil {
+			return t
+		}
+		if dir == filepath.Clean(root) || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if fi, err := os.Stat(path); err == nil {
+		return fi.ModTime()
+	}
+	return time.Now()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// githubAPI makes requests to the github rest api.
+type githubAPI struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+func newGitHubAPI(client *http.Client, token string) *githubAPI {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	return &githubAPI{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), token: token}
+}
+
+// do sends a request with the value encoded as json and decodes the json
+// response into out when it is not nil.
+func (api *githubAPI) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, api.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+api.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("github returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// writeGitHubCheck creates a completed check run with the summary of the run
+// on the commit being built, or updates the check run with the same name
+// when the commit already has one. The repository and commit are read from
+// the environment of github actions.
+func (c *converter) writeGitHubCheck(api *githubAPI, name, detailsURL string) error {
+	repo, sha := os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_SHA")
+	if repo == "" || sha == "" {
+		return fmt.Errorf("GITHUB_REPOSITORY and GITHUB_SHA must be set")
+	}
+
+	var summary strings.Builder
+	if err := c.writeMarkdownSummary(&summary, nil, ""); err != nil {
+		return err
+	}
+	conclusion := "success"
+	if c.failedCount() > 0 {
+		conclusion = "failure"
+	}
+	run := map[string]interface{}{
+		"name":       name,
+		"head_sha":   sha,
+		"status":     "completed",
+		"conclusion": conclusion,
+		"output": map[string]string{
+			"title":   c.runText(),
+			"summary": summary.String(),
+		},
+	}
+	if detailsURL != "" {
+		run["details_url"] = detailsURL
+	}
+
+	var existing struct {
+		CheckRuns []struct {
+			ID int64 `json:"id"`
+		} `json:"check_runs"`
+	}
+	path := fmt.Sprintf("/repos/%s/commits/%s/check-runs?check_name=%s", repo, sha, url.QueryEscape(name))
+	if err := api.do("GET", path, nil, &existing); err != nil {
+		return err
+	}
+	if len(existing.CheckRuns) > 0 {
+		return api.do("PATCH", fmt.Sprintf("/repos/%s/check-runs/%d", repo, existing.CheckRuns[0].ID), run, nil)
+	}
+	return api.do("POST", fmt.Sprintf("/repos/%s/check-runs", repo), run, nil)
+}
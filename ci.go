@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ciProvider describes how to read the build metadata of a CI provider from
+// the environment.
+type ciProvider struct {
+	// name is written as the ci_provider tag.
+	name string
+
+	// detect lists the environment variables that are set when running
+	// under the provider. The provider is detected if any of them is set.
+	// An entry of the form NAME=value only matches that value.
+	detect []string
+
+	// tags and fields map each tag or field to the environment variables
+	// it is read from. The first variable that is set is used.
+	tags   map[string][]string
+	fields map[string][]string
+
+	// enrich adds metadata that cannot be read directly from a single
+	// environment variable.
+	enrich func(tags map[string]string, fields map[string]interface{})
+}
+
+var ciProviders = []ciProvider{
+	{
+		name:   "github_actions",
+		detect: []string{"GITHUB_ACTIONS"},
+		tags: map[string][]string{
+			"build_number": {"GITHUB_RUN_NUMBER"},
+			"branch":       {"GITHUB_HEAD_REF", "GITHUB_REF_NAME"},
+			"commit":       {"GITHUB_SHA"},
+			"job_name":     {"GITHUB_JOB"},
+			"workflow":     {"GITHUB_WORKFLOW"},
+		},
+		fields: map[string][]string{
+			"run_id":      {"GITHUB_RUN_ID"},
+			"run_attempt": {"GITHUB_RUN_ATTEMPT"},
+		},
+		enrich: func(tags map[string]string, fields map[string]interface{}) {
+			// Pull requests are checked out from refs/pull/<number>/merge.
+			ref := os.Getenv("GITHUB_REF")
+			if strings.HasPrefix(ref, "refs/pull/") {
+				if parts := strings.Split(ref, "/"); len(parts) >= 3 {
+					tags["pr_number"] = parts[2]
+				}
+			}
+		},
+	},
+	{
+		name:   "gitlab",
+		detect: []string{"GITLAB_CI"},
+		tags: map[string][]string{
+			"build_number": {"CI_PIPELINE_IID"},
+			"branch":       {"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "CI_COMMIT_REF_NAME"},
+			"commit":       {"CI_COMMIT_SHA"},
+			"job_name":     {"CI_JOB_NAME"},
+			"stage":        {"CI_JOB_STAGE"},
+			"pr_number":    {"CI_MERGE_REQUEST_IID"},
+		},
+		fields: map[string][]string{
+			"pipeline_id": {"CI_PIPELINE_ID"},
+			"job_id":      {"CI_JOB_ID"},
+		},
+	},
+	{
+		name:   "jenkins",
+		detect: []string{"JENKINS_URL", "JENKINS_HOME"},
+		tags: map[string][]string{
+			"build_number": {"BUILD_NUMBER"},
+			"branch":       {"CHANGE_BRANCH", "BRANCH_NAME", "GIT_BRANCH"},
+			"commit":       {"GIT_COMMIT"},
+			"job_name":     {"JOB_NAME"},
+			"node_name":    {"NODE_NAME"},
+			"pr_number":    {"CHANGE_ID"},
+		},
+		fields: map[string][]string{
+			"build_url":       {"BUILD_URL"},
+			"executor_number": {"EXECUTOR_NUMBER"},
+		},
+	},
+	{
+		name:   "circleci",
+		detect: []string{"CIRCLECI"},
+		tags: map[string][]string{
+			"build_number": {"CIRCLE_BUILD_NUM"},
+			"branch":       {"CIRCLE_BRANCH"},
+			"commit":       {"CIRCLE_SHA1"},
+			"job_name":     {"CIRCLE_JOB"},
+			"pr_number":    {"CIRCLE_PR_NUMBER"},
+			// The index of the container in a parallel job, so the
+			// shards of a sharded run can be queried together.
+			"parallel_index": {"CIRCLE_NODE_INDEX"},
+		},
+		fields: map[string][]string{
+			"parallel_total": {"CIRCLE_NODE_TOTAL"},
+			"workflow_id":    {"CIRCLE_WORKFLOW_ID"},
+		},
+	},
+	{
+		name:   "buildkite",
+		detect: []string{"BUILDKITE"},
+		tags: map[string][]string{
+			"build_number":   {"BUILDKITE_BUILD_NUMBER"},
+			"branch":         {"BUILDKITE_BRANCH"},
+			"commit":         {"BUILDKITE_COMMIT"},
+			"job_name":       {"BUILDKITE_LABEL"},
+			"pipeline":       {"BUILDKITE_PIPELINE_SLUG"},
+			"agent_name":     {"BUILDKITE_AGENT_NAME"},
+			"parallel_index": {"BUILDKITE_PARALLEL_JOB"},
+		},
+		fields: map[string][]string{
+			"parallel_total": {"BUILDKITE_PARALLEL_JOB_COUNT"},
+			"build_id":       {"BUILDKITE_BUILD_ID"},
+		},
+		enrich: func(tags map[string]string, fields map[string]interface{}) {
+			// The pull request is "false" for builds of a branch.
+			if pr := os.Getenv("BUILDKITE_PULL_REQUEST"); pr != "" && pr != "false" {
+				tags["pr_number"] = pr
+			}
+		},
+	},
+	{
+		name:   "azure_pipelines",
+		detect: []string{"TF_BUILD"},
+		tags: map[string][]string{
+			"build_number": {"BUILD_BUILDNUMBER"},
+			"branch":       {"SYSTEM_PULLREQUEST_SOURCEBRANCH", "BUILD_SOURCEBRANCHNAME"},
+			"commit":       {"BUILD_SOURCEVERSION"},
+			"job_name":     {"SYSTEM_JOBDISPLAYNAME"},
+			"pipeline":     {"SYSTEM_DEFINITIONNAME"},
+			"stage":        {"SYSTEM_STAGEDISPLAYNAME"},
+			"agent_name":   {"AGENT_NAME"},
+			"pr_number":    {"SYSTEM_PULLREQUEST_PULLREQUESTNUMBER"},
+		},
+		fields: map[string][]string{
+			"build_id":      {"BUILD_BUILDID"},
+			"stage_attempt": {"SYSTEM_STAGEATTEMPT"},
+			"job_attempt":   {"SYSTEM_JOBATTEMPT"},
+		},
+	},
+	{
+		name:   "teamcity",
+		detect: []string{"TEAMCITY_VERSION"},
+		tags: map[string][]string{
+			"build_number": {"BUILD_NUMBER"},
+			"job_name":     {"TEAMCITY_BUILD_CONF_NAME"},
+			"pipeline":     {"TEAMCITY_PROJECT_NAME"},
+		},
+		enrich: enrichTeamCity,
+	},
+	{
+		// Woodpecker is checked before Drone since older versions also
+		// set the DRONE_ variables for compatibility.
+		name:   "woodpecker",
+		detect: []string{"CI=woodpecker"},
+		tags: map[string][]string{
+			"build_number": {"CI_PIPELINE_NUMBER"},
+			"repository":   {"CI_REPO"},
+			"branch":       {"CI_COMMIT_SOURCE_BRANCH", "CI_COMMIT_BRANCH"},
+			"commit":       {"CI_COMMIT_SHA"},
+			"job_name":     {"CI_STEP_NAME"},
+			"event":        {"CI_PIPELINE_EVENT"},
+			"pr_number":    {"CI_COMMIT_PULL_REQUEST"},
+		},
+	},
+	{
+		name:   "drone",
+		detect: []string{"DRONE"},
+		tags: map[string][]string{
+			"build_number": {"DRONE_BUILD_NUMBER"},
+			"repository":   {"DRONE_REPO"},
+			"branch":       {"DRONE_SOURCE_BRANCH", "DRONE_BRANCH"},
+			"commit":       {"DRONE_COMMIT_SHA"},
+			"job_name":     {"DRONE_STEP_NAME"},
+			"event":        {"DRONE_BUILD_EVENT"},
+			"pr_number":    {"DRONE_PULL_REQUEST"},
+		},
+	},
+	{
+		name:   "travis",
+		detect: []string{"TRAVIS"},
+		tags: map[string][]string{
+			"build_number": {"TRAVIS_BUILD_NUMBER"},
+			"branch":       {"TRAVIS_PULL_REQUEST_BRANCH", "TRAVIS_BRANCH"},
+			"commit":       {"TRAVIS_COMMIT"},
+			"job_name":     {"TRAVIS_JOB_NAME"},
+		},
+	},
+}
+
+// detectCI returns the tags and fields for the CI provider the tool is
+// running under. It returns nil maps when no provider is detected.
+func detectCI() (map[string]string, map[string]interface{}) {
+	for _, p := range ciProviders {
+		if !anyEnvSet(p.detect) {
+			continue
+		}
+		tags := map[string]string{"ci_provider": p.name}
+		fields := make(map[string]interface{})
+		for tag, names := range p.tags {
+			if v := firstEnv(names); v != "" {
+				tags[tag] = v
+			}
+		}
+		for field, names := range p.fields {
+			if v := firstEnv(names); v != "" {
+				fields[field] = parseFieldValue(v)
+			}
+		}
+		if p.enrich != nil {
+			p.enrich(tags, fields)
+		}
+		return tags, fields
+	}
+	return nil, nil
+}
+
+// teamCityProperties maps the TeamCity build properties to tags and fields.
+var teamCityProperties = map[string]string{
+	"build.vcs.number":      "commit",
+	"teamcity.build.branch": "branch",
+	"agent.name":            "agent_name",
+}
+
+// enrichTeamCity reads the metadata that TeamCity only exposes through the
+// build properties file and the configuration properties file it refers to.
+func enrichTeamCity(tags map[string]string, fields map[string]interface{}) {
+	path := os.Getenv("TEAMCITY_BUILD_PROPERTIES_FILE")
+	if path == "" {
+		return
+	}
+	props, err := readJavaProperties(path)
+	if err != nil {
+		return
+	}
+	if confPath := props["teamcity.configuration.properties.file"]; confPath != "" {
+		if conf, err := readJavaProperties(confPath); err == nil {
+			for k, v := range conf {
+				if _, ok := props[k]; !ok {
+					props[k] = v
+				}
+			}
+		}
+	}
+
+	for prop, tag := range teamCityProperties {
+		if v := props[prop]; v != "" {
+			tags[tag] = v
+		}
+	}
+	if v := props["teamcity.build.id"]; v != "" {
+		fields["build_id"] = parseFieldValue(v)
+	}
+}
+
+// readJavaProperties reads a java properties file. Line continuations are
+// not supported since TeamCity does not write them.
+func readJavaProperties(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			continue
+		}
+		key := unescapeJavaProperty(strings.TrimSpace(line[:i]))
+		props[key] = unescapeJavaProperty(strings.TrimSpace(line[i+1:]))
+	}
+	return props, nil
+}
+
+// unescapeJavaProperty removes the backslash escapes from a property key
+// or value.
+func unescapeJavaProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			default:
+				buf.WriteByte(s[i])
+			}
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// selectCITags limits the CI tags to the ones named in the specs. Each spec
+// is a tag name or name=newname to write the tag with a different name. All
+// of the tags are returned when there are no specs.
+func selectCITags(tags map[string]string, specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return tags, nil
+	}
+	selected := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, rename := spec, spec
+		if i := strings.IndexByte(spec, '='); i >= 0 {
+			name, rename = spec[:i], spec[i+1:]
+		}
+		if name == "" || rename == "" {
+			return nil, fmt.Errorf("expected name or name=newname: %s", spec)
+		}
+		if v, ok := tags[name]; ok {
+			selected[rename] = v
+		}
+	}
+	return selected, nil
+}
+
+func anyEnvSet(names []string) bool {
+	for _, name := range names {
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			if os.Getenv(name[:i]) == name[i+1:] {
+				return true
+			}
+		} else if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// firstEnv returns the value of the first environment variable that is set.
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseMatrixTags parses a GitHub Actions matrix context, as written by
+// toJSON(matrix), into matrix_<key> tags. Values that are not strings are
+// written as JSON.
+func parseMatrixTags(s string) (map[string]string, error) {
+	var matrix map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &matrix); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(matrix))
+	for k, v := range matrix {
+		if str, ok := v.(string); ok {
+			tags["matrix_"+k] = str
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		tags["matrix_"+k] = string(b)
+	}
+	return tags, nil
+}
+
+// influxQueryURL returns the url of a query for the testcase points of this
+// run. The points are selected with the CI tags that identify the run.
+func influxQueryURL(host, db, measurement string, tags map[string]string) string {
+	var conds []string
+	for _, k := range []string{"ci_provider", "workflow", "job_name", "build_number"} {
+		if v, ok := tags[k]; ok {
+			conds = append(conds, fmt.Sprintf(`"%s" = '%s'`, k, strings.Replace(v, "'", `\'`, -1)))
+		}
+	}
+	q := fmt.Sprintf(`SELECT * FROM "%s"`, strings.Replace(measurement, `"`, `\"`, -1))
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	v := url.Values{"db": {db}, "q": {q}}
+	return strings.TrimSuffix(host, "/") + "/query?" + v.Encode()
+}
+
+// writeGitHubJobSummary appends the run totals and an optional link to the
+// results to the GitHub Actions job summary.
+func (c *converter) writeGitHubJobSummary(queryURL string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return fmt.Errorf("GITHUB_STEP_SUMMARY is not set")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	buf.WriteString("### Test results\n\n")
+	buf.WriteString("| Tests | Failures | Errors | Skipped | Duration |\n")
+	buf.WriteString("| ---: | ---: | ---: | ---: | ---: |\n")
+	fmt.Fprintf(&buf, "| %d | %d | %d | %d | %.3fs |\n", c.run.tests, c.run.failures, c.run.errors, c.run.skipped, c.run.duration)
+	if queryURL != "" {
+		fmt.Fprintf(&buf, "\n[Query the results in InfluxDB](%s)\n", queryURL)
+	}
+	buf.WriteString("\n")
+	if _, err := f.WriteString(buf.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
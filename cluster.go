@@ -0,0 +1,116 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxClusterMessage is the length in bytes that normalized failure messages
+// are truncated to.
+const maxClusterMessage = 200
+
+// failureNoise matches the parts of a failure message that change between
+// runs of the same failure. They are replaced in order so the timestamps
+// and identifiers are replaced before the numbers within them.
+var failureNoise = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<addr>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)*(ns|us|ms|s|m|h)?\b`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// normalizeFailure returns the message of a failure without the line
+// numbers, addresses, timestamps, and other values that differ between
+// otherwise identical failures. The first line of the text is used when
+// there is no message.
+func normalizeFailure(f *Failure) string {
+	msg := f.Message
+	if strings.TrimSpace(msg) == "" {
+		msg = strings.TrimSpace(f.Text)
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[:i]
+		}
+	}
+	for _, n := range failureNoise {
+		msg = n.re.ReplaceAllString(msg, n.repl)
+	}
+	msg = strings.TrimSpace(msg)
+	if n := maxClusterMessage; len(msg) > n {
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n]
+	}
+	return msg
+}
+
+// failureCluster is a group of failures of the run with the same type and
+// normalized message.
+type failureCluster struct {
+	failureType string
+	message     string
+	count       int
+	suites      map[string]bool
+
+	// example is the first testcase with the failure.
+	example testKey
+}
+
+// addFailure adds a failed testcase to its cluster.
+func (r *runTotals) addFailure(testsuite *TestSuite, testcase *TestCase) {
+	f := testcase.Failure
+	if testcase.Error != nil {
+		f = testcase.Error
+	}
+	if f == nil {
+		return
+	}
+	message := normalizeFailure(f)
+	key := f.Type + "\x00" + message
+	cl, ok := r.clusters[key]
+	if !ok {
+		if r.clusters == nil {
+			r.clusters = make(map[string]*failureCluster)
+		}
+		cl = &failureCluster{
+			failureType: f.Type,
+			message:     message,
+			suites:      make(map[string]bool),
+			example:     testKey{Suite: testsuite.Name, ClassName: testcase.ClassName, Name: testcase.Name},
+		}
+		r.clusters[key] = cl
+		r.clusterOrder = append(r.clusterOrder, key)
+	}
+	cl.count++
+	cl.suites[testsuite.Name] = true
+}
+
+// writeFailureClusters writes a point for each cluster of failures in the
+// run with the number of testcases that failed with it. The cluster tag is
+// a hash of the type and normalized message so the same failure has the
+// same series in every run.
+func (c *converter) writeFailureClusters(pw PointsWriter, measurement string, now time.Time) error {
+	for _, key := range c.run.clusterOrder {
+		cl := c.run.clusters[key]
+		tags := map[string]string{"cluster": hashString(key)}
+		if cl.failureType != "" {
+			tags["failure_type"] = cl.failureType
+		}
+		fields := map[string]interface{}{
+			"count":        cl.count,
+			"suites":       len(cl.suites),
+			"message":      cl.message,
+			"example_test": cl.example.Name,
+		}
+		if err := c.writePoint(pw, measurement, newTemplateData(nil, nil), tags, fields, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
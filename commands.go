@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// command is a subcommand of the tool.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+
+	// flags defines the options of the command. It is used to generate
+	// the shell completions and is nil for commands without options.
+	flags func(fs *pflag.FlagSet)
+
+	// hidden commands are left out of the usage and completions.
+	hidden bool
+}
+
+// commands lists the subcommands. When the first argument is not the name
+// of a command, the arguments are passed to ingest so the tool can still be
+// used without a subcommand, unless the argument looks like a misspelled
+// command.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "ingest", summary: "write the points for junit reports", run: ingest, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs) }},
+		{name: "exec", summary: "run a test command and write the points for its reports", run: execCommand, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs); addExecFlags(fs) }},
+		{name: "serve", summary: "accept report uploads over http and write their points", run: serve, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs); addServeFlags(fs) }},
+		{name: "watch", summary: "write the points for the reports that appear in a directory", run: watch, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs); addWatchFlags(fs) }},
+		{name: "fetch", summary: "write the points for the reports in the artifacts of a github or gitlab run", run: fetch, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs); addFetchFlags(fs) }},
+		{name: "report", summary: "query the results in influxdb for reports such as the flaky tests", run: report, flags: func(fs *pflag.FlagSet) { addReportFlags(fs) }},
+		{name: "history", summary: "show the status and duration of a test across branches and builds", run: history, flags: func(fs *pflag.FlagSet) { addHistoryFlags(fs) }},
+		{name: "backfill", summary: "write the points for an archive of old reports with their original times", run: backfill, flags: func(fs *pflag.FlagSet) { newIngestOptions(fs); addBackfillFlags(fs) }},
+		{name: "downsample", summary: "print or create the continuous queries or flux tasks that aggregate the testcase points", run: downsample, flags: func(fs *pflag.FlagSet) { addDownsampleFlags(fs) }},
+		{name: "alerts", summary: "print alert definitions for kapacitor, influxdb, or grafana for common test conditions", run: alerts, flags: func(fs *pflag.FlagSet) { addAlertsFlags(fs) }},
+		{name: "diff", summary: "compare the testcases of two reports", run: diff, flags: func(fs *pflag.FlagSet) { addDiffFlags(fs) }},
+		{name: "validate", summary: "check that junit reports can be read", run: validate, flags: func(fs *pflag.FlagSet) { addLogFlags(fs) }},
+		{name: "completion", summary: "generate shell completions for bash, zsh, or fish", run: completion},
+		{name: "version", summary: "print the version", run: func([]string) { printVersion() }},
+		{name: "help", summary: "show this help", run: func([]string) { usage() }},
+		{name: "gen-man", summary: "generate the man page", run: genMan, hidden: true},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "--help":
+			usage()
+			return
+		case "--version":
+			printVersion()
+			return
+		}
+		for _, cmd := range commands {
+			if cmd.name == args[0] {
+				cmd.run(args[1:])
+				return
+			}
+		}
+		if looksLikeCommand(args[0]) {
+			logger.Exitf(exitUsage, "Unknown command: %s", args[0])
+		}
+	}
+	ingest(args)
+}
+
+// looksLikeCommand reports whether an argument that is not the name of a
+// command was meant to be one rather than a report for ingest. Reports are
+// expected to have a directory or an extension in their name unless they
+// exist.
+func looksLikeCommand(arg string) bool {
+	if arg == "" || strings.HasPrefix(arg, "-") || strings.ContainsAny(arg, `./\*?[`) {
+		return false
+	}
+	_, err := os.Stat(arg)
+	return os.IsNotExist(err)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: influx-junit [command] [options] <file>...\n\nCommands:\n")
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\nThe ingest command is used when no command is given. Use \"influx-junit <command> --help\" for the options of a command.\n")
+	fmt.Fprintf(os.Stderr, `
+Exit codes:
+  %d  an unexpected error
+  %d  invalid options or config file
+  %d  a report could not be read or converted
+  %d  no points could be written to the server
+  %d  only some of the points could be written to the server
+  %d  the run failed a --fail-if condition
+  %d  the run stopped at the --max-series limit
+`, exitFailure, exitUsage, exitParse, exitConnection, exitPartialWrite, exitGate, exitSeriesLimit)
+}
+
+// commandUsage returns the usage function for the flags of a command.
+func commandUsage(fs *pflag.FlagSet, synopsis string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage: influx-junit %s\n\nOptions:\n%s", synopsis, fs.FlagUsages())
+	}
+}
+
+// validate reads each report and prints its totals. It exits with exitParse
+// if any of the reports could not be read.
+func validate(args []string) {
+	fs := pflag.NewFlagSet("validate", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "validate <file>...")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+	if err := logOpts.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		logger.Exitf(exitUsage, "Must specify at least one argument")
+	}
+
+	failed := false
+	for _, path := range files {
+		tests, err := readTestSuitesFile(path)
+		if err != nil {
+			logger.Errorf("%s", err)
+			failed = true
+			continue
+		}
+
+		var total TestSuite
+		for _, testsuite := range tests.Items {
+			total.Tests += testsuite.Tests
+			total.Failures += testsuite.Failures
+			total.Errors += testsuite.Errors
+			total.Skipped += testsuite.Skipped
+			if len(testsuite.TestCases) != testsuite.Tests {
+				logger.Warnf("%s: testsuite %s reports %d tests but has %d testcases", path, testsuite.Name, testsuite.Tests, len(testsuite.TestCases))
+			}
+		}
+		fmt.Printf("%s: %d suites, %d tests, %d failures, %d errors, %d skipped\n", path, len(tests.Items), total.Tests, total.Failures, total.Errors, total.Skipped)
+	}
+	if failed {
+		os.Exit(exitParse)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// flagValues lists the values that are completed for options that only
+// accept a fixed set of values.
+var flagValues = map[string][]string{
+	"condition":            {"pass-rate", "flaky", "duration"},
+	"dedup":                {"first", "last", "worst", "merge"},
+	"duration-type":        {"float", "int"},
+	"duration-unit":        {"s", "ms", "us"},
+	"format":               {"text", "csv", "json"},
+	"list-format":          {"list", "go", "pytest"},
+	"language":             {"influxql", "flux"},
+	"log-format":           {"text", "json"},
+	"notify-format":        {"slack", "json"},
+	"output-format":        {"line", "jsonl", "csv", "parquet"},
+	"precision":            {"s", "ms", "us", "ns"},
+	"report-file-tag":      {"base", "path"},
+	"schema":               {"v1", "v2"},
+	"scrub":                {"email", "ipv4", "uuid"},
+	"status-as":            {"tag", "field", "both"},
+	"target":               {"kapacitor", "influxdb", "grafana"},
+	"time-scope":           {"run", "file", "suite"},
+	"time-source":          {"now", "suite", "timeline", "mtime"},
+	"writer-plugin-format": {"line", "jsonl"},
+}
+
+// completion writes the completion script for a shell to stdout.
+func completion(args []string) {
+	fs := pflag.NewFlagSet("completion", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "completion bash|zsh|fish")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	switch shell := fs.Arg(0); shell {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		// zsh can load bash completions through bashcompinit.
+		fmt.Fprintln(os.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+		writeBashCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	default:
+		logger.Exitf(exitUsage, "Unsupported shell: %s", shell)
+	}
+}
+
+// commandFlags returns the options of a command sorted by name.
+func commandFlags(cmd command) []*pflag.Flag {
+	fs := pflag.NewFlagSet(cmd.name, pflag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	var flags []*pflag.Flag
+	fs.VisitAll(func(f *pflag.Flag) {
+		flags = append(flags, f)
+	})
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			names = append(names, cmd.name)
+		}
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintf(w, `_influx_junit() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local cmd=ingest
+    case "${COMP_WORDS[1]}" in
+    %s)
+        if [[ $COMP_CWORD -gt 1 ]]; then
+            cmd="${COMP_WORDS[1]}"
+        fi
+        ;;
+    esac
+
+    case "$cmd:$prev" in
+`, strings.Join(commandNames(), "|"))
+
+	for _, cmd := range commands {
+		for _, f := range commandFlags(cmd) {
+			if values, ok := flagValues[f.Name]; ok {
+				fmt.Fprintf(w, "    %s:--%s)\n        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n        return\n        ;;\n", cmd.name, f.Name, strings.Join(values, " "))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, `    esac
+
+    if [[ "$cur" == -* ]]; then
+        case "$cmd" in
+`)
+	for _, cmd := range commands {
+		if cmd.hidden {
+			continue
+		}
+		var words []string
+		for _, f := range commandFlags(cmd) {
+			words = append(words, "--"+f.Name)
+			if f.Shorthand != "" {
+				words = append(words, "-"+f.Shorthand)
+			}
+		}
+		fmt.Fprintf(w, "        %s)\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n            ;;\n", cmd.name, strings.Join(words, " "))
+	}
+	fmt.Fprintf(w, `        esac
+        return
+    fi
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur") $(compgen -f -- "$cur"))
+        return
+    fi
+    if [[ "$cmd" == completion ]]; then
+        COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -o filenames -F _influx_junit influx-junit
+`, strings.Join(commandNames(), " "))
+}
+
+func writeFishCompletion(w io.Writer) {
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			fmt.Fprintf(w, "complete -c influx-junit -n '__fish_use_subcommand' -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+		}
+	}
+
+	others := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		if cmd.name != "ingest" {
+			others = append(others, cmd.name)
+		}
+	}
+	for _, cmd := range commands {
+		// The options of ingest are also used when no command is given.
+		cond := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "ingest" {
+			cond = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c influx-junit -n '%s' -l %s", cond, f.Name)
+			if f.Shorthand != "" {
+				line += " -s " + f.Shorthand
+			}
+			if values, ok := flagValues[f.Name]; ok {
+				line += " -x -a " + fishQuote(strings.Join(values, " "))
+			} else if f.Value.Type() != "bool" {
+				line += " -r"
+			}
+			fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(f.Usage))
+		}
+	}
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// defaultConfigFile is read from the working directory when no config file
+// is given.
+const defaultConfigFile = "influx-junit.yaml"
+
+// readConfigFile reads a yaml config file. The keys are the names of the
+// command line options:
+//
+//	host: http://influxdb:8086
+//	database: ci
+//	tag:
+//	  team: platform
+//	  os: linux
+//	exclude-suite: [flaky]
+//	suite-summaries: true
+//
+// Lists set an option that may be repeated once for each element and
+// mappings set it once for each key=value pair. The schema-mapping option
+// may be a mapping with the contents of a schema mapping file.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return yamlMap(v)
+}
+
+// findConfigFile returns the config file to read. It returns an empty
+// string if none was given and the default config file does not exist.
+func findConfigFile(path string) string {
+	if path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+	return ""
+}
+
+// envPrefix is the prefix of the environment variables that set options.
+const envPrefix = "INFLUX_JUNIT_"
+
+// applyEnv sets the options that were not set on the command line from the
+// environment. The variable for an option is its name in upper case with
+// dashes replaced by underscores, such as INFLUX_JUNIT_RETENTION_POLICY.
+// Options that may be repeated are given as a comma separated list.
+func applyEnv(fs *pflag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(flag.Name, "-", "_", -1))
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		values := []string{v}
+		if flag.Value.Type() == "stringArray" {
+			values = strings.Split(v, ",")
+		}
+		for _, v := range values {
+			if e := fs.Set(flag.Name, v); e != nil {
+				err = fmt.Errorf("%s: %s", name, e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// applyConfig sets the options from the config file that were not already
+// set on the command line or in the environment.
+func applyConfig(fs *pflag.FlagSet, cfg map[string]interface{}) error {
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flag := fs.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		values, err := configValues(cfg[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues returns the values to set an option to.
+func configValues(v interface{}) ([]string, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return yamlStrings(v)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0, len(m))
+	for _, k := range keys {
+		s, err := yamlString(m[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+		values = append(values, k+"="+s)
+	}
+	return values, nil
+}
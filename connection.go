@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+	"github.com/spf13/pflag"
+)
+
+// connectionOptions are the options shared by the commands that connect to
+// the influxdb server.
+type connectionOptions struct {
+	host            string
+	username        string
+	password        string
+	database        string
+	retentionPolicy string
+	precision       string
+	retries         int
+	retryBackoff    time.Duration
+	timeout         time.Duration
+	proxy           string
+
+	createDatabase    bool
+	createBucket      bool
+	org               string
+	token             string
+	retentionDuration time.Duration
+}
+
+func addConnectionFlags(fs *pflag.FlagSet) *connectionOptions {
+	o := &connectionOptions{}
+	fs.StringVarP(&o.host, "host", "H", "http://localhost:8086", "influxdb server to write to")
+	fs.StringVarP(&o.username, "username", "u", "", "influxdb username")
+	fs.StringVarP(&o.password, "password", "p", "", "influxdb password")
+	fs.StringVarP(&o.database, "database", "d", "", "influxdb database")
+	fs.StringVarP(&o.retentionPolicy, "retention-policy", "r", "", "influxdb retention policy")
+	fs.StringVar(&o.precision, "precision", "ns", "precision of the written timestamps (s, ms, us, ns)")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "time to wait for each request to the server; 0 waits forever")
+	fs.StringVar(&o.proxy, "proxy", "", "proxy url for the requests to the server; HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are used by default")
+	fs.BoolVar(&o.createDatabase, "create-database", false, "create the database and the retention policy if they do not exist")
+	fs.BoolVar(&o.createBucket, "create-bucket", false, "create the influxdb 2 bucket named database/retention-policy, or database without a retention policy, if it does not exist")
+	fs.StringVar(&o.org, "org", "", "influxdb 2 organization of the bucket created by --create-bucket")
+	fs.StringVar(&o.token, "token", "", "influxdb 2 api token used by --create-bucket; defaults to the password")
+	fs.DurationVar(&o.retentionDuration, "retention-duration", 0, "duration of the retention policy or bucket created by --create-database or --create-bucket; 0 keeps the data forever")
+	fs.IntVar(&o.retries, "retries", 0, "retry writes that fail with a server error or a network error this many times")
+	fs.DurationVar(&o.retryBackoff, "retry-backoff", time.Second, "delay before the first retry; it doubles with each retry unless the server sends a Retry-After header")
+	return o
+}
+
+// addQueryFlags adds the options needed to query the influxdb server for
+// the commands that only read from it.
+func addQueryFlags(fs *pflag.FlagSet) *connectionOptions {
+	o := &connectionOptions{}
+	fs.StringVarP(&o.host, "host", "H", "http://localhost:8086", "influxdb server to query")
+	fs.StringVarP(&o.username, "username", "u", "", "influxdb username")
+	fs.StringVarP(&o.password, "password", "p", "", "influxdb password")
+	fs.StringVarP(&o.database, "database", "d", "", "influxdb database")
+	fs.StringVarP(&o.retentionPolicy, "retention-policy", "r", "", "influxdb retention policy")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "time to wait for each request to the server; 0 waits forever")
+	fs.StringVar(&o.proxy, "proxy", "", "proxy url for the requests to the server; HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are used by default")
+	return o
+}
+
+// writePrecision returns the precision in the form used by the client.
+func (o *connectionOptions) writePrecision() (string, bool) {
+	precisions := map[string]string{"s": "s", "ms": "ms", "us": "u", "ns": ""}
+	precision, ok := precisions[o.precision]
+	return precision, ok
+}
+
+// proxyFunc returns the proxy function for the requests to the server.
+func (o *connectionOptions) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if o.proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(o.proxy)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%s is not an absolute url", o.proxy)
+	}
+	return http.ProxyURL(u), nil
+}
+
+func (o *connectionOptions) newClient() (influxdb.Client, error) {
+	proxy, err := o.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	return influxdb.NewHTTPClient(influxdb.HTTPConfig{
+		Addr:     o.host,
+		Username: o.username,
+		Password: o.password,
+		Timeout:  o.timeout,
+		Proxy:    proxy,
+	})
+}
+
+// httpClient returns the client used for the requests the influxdb client
+// cannot make.
+func (o *connectionOptions) httpClient() (*http.Client, error) {
+	proxy, err := o.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = proxy
+	return &http.Client{Transport: tr, Timeout: o.timeout}, nil
+}
+
+// check pings the server and checks that the database exists so a problem
+// with the server is found before any of the reports are read.
+func (o *connectionOptions) check() error {
+	client, err := o.newClient()
+	if err != nil {
+		return fmt.Errorf("Could not create HTTP client: %s", err)
+	}
+	defer client.Close()
+
+	elapsed, version, err := client.Ping(10 * time.Second)
+	if err != nil {
+		return fmt.Errorf("Could not connect to %s: %s", o.host, err)
+	}
+	logger.Info("Connected to influxdb", "host", o.host, "version", version, "elapsed", elapsed)
+
+	if o.database == "" {
+		return nil
+	}
+	exists, err := databaseExists(client, o.database)
+	if err != nil {
+		return fmt.Errorf("Could not list the databases on %s: %s", o.host, err)
+	} else if !exists {
+		return fmt.Errorf("Database %s does not exist on %s", o.database, o.host)
+	}
+	return nil
+}
+
+// ensureDatabase creates the database and the retention policy when they do
+// not exist. A new database is created with the retention policy as its
+// default; a retention policy added to an existing database is not made
+// the default.
+func (o *connectionOptions) ensureDatabase() error {
+	client, err := o.newClient()
+	if err != nil {
+		return fmt.Errorf("Could not create HTTP client: %s", err)
+	}
+	defer client.Close()
+
+	exists, err := databaseExists(client, o.database)
+	if err != nil {
+		return fmt.Errorf("Could not list the databases on %s: %s", o.host, err)
+	}
+
+	duration := "INF"
+	if o.retentionDuration > 0 {
+		duration = fmt.Sprintf("%ds", int64(o.retentionDuration/time.Second))
+	}
+
+	var stmt string
+	if !exists {
+		stmt = "CREATE DATABASE " + quoteIdent(o.database)
+		if o.retentionPolicy != "" || o.retentionDuration > 0 {
+			stmt += " WITH DURATION " + duration
+		}
+		if o.retentionPolicy != "" {
+			stmt += " NAME " + quoteIdent(o.retentionPolicy)
+		}
+	} else if o.retentionPolicy != "" {
+		exists, err := retentionPolicyExists(client, o.database, o.retentionPolicy)
+		if err != nil {
+			return fmt.Errorf("Could not list the retention policies of %s: %s", o.database, err)
+		} else if exists {
+			return nil
+		}
+		stmt = fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1",
+			quoteIdent(o.retentionPolicy), quoteIdent(o.database), duration)
+	} else {
+		return nil
+	}
+
+	if err := query(client, stmt); err != nil {
+		return fmt.Errorf("Could not create %s: %s", o.database, err)
+	}
+	logger.Info("Created database", "database", o.database, "retention_policy", o.retentionPolicy, "duration", duration)
+	return nil
+}
+
+// bucket returns the name of the influxdb 2 bucket that the database and
+// retention policy are mapped to by the 1.x compatibility api.
+func (o *connectionOptions) bucket() string {
+	if o.retentionPolicy == "" {
+		return o.database
+	}
+	return o.database + "/" + o.retentionPolicy
+}
+
+// ensureBucket creates the influxdb 2 bucket for the database and retention
+// policy when it does not exist. The 1.x compatibility api writes to a
+// bucket named database/retention-policy when there is no mapping for it.
+func (o *connectionOptions) ensureBucket() error {
+	client, err := o.httpClient()
+	if err != nil {
+		return fmt.Errorf("Could not create HTTP client: %s", err)
+	}
+	token := o.token
+	if token == "" {
+		token = o.password
+	}
+	api := &influxAPI{client: client, host: strings.TrimSuffix(o.host, "/"), token: token}
+
+	name := o.bucket()
+	var buckets struct {
+		Buckets []struct {
+			Name string `json:"name"`
+		} `json:"buckets"`
+	}
+	if err := api.do("GET", "/api/v2/buckets?"+url.Values{"org": {o.org}, "name": {name}}.Encode(), nil, &buckets); err != nil {
+		return fmt.Errorf("Could not list the buckets on %s: %s", o.host, err)
+	}
+	for _, b := range buckets.Buckets {
+		if b.Name == name {
+			return nil
+		}
+	}
+
+	var orgs struct {
+		Orgs []struct {
+			ID string `json:"id"`
+		} `json:"orgs"`
+	}
+	if err := api.do("GET", "/api/v2/orgs?"+url.Values{"org": {o.org}}.Encode(), nil, &orgs); err != nil {
+		return fmt.Errorf("Could not find the organization %s: %s", o.org, err)
+	} else if len(orgs.Orgs) == 0 {
+		return fmt.Errorf("Organization %s does not exist on %s", o.org, o.host)
+	}
+
+	bucket := map[string]interface{}{
+		"orgID":          orgs.Orgs[0].ID,
+		"name":           name,
+		"retentionRules": []interface{}{},
+	}
+	if o.retentionDuration > 0 {
+		bucket["retentionRules"] = []interface{}{
+			map[string]interface{}{"type": "expire", "everySeconds": int64(o.retentionDuration / time.Second)},
+		}
+	}
+	if err := api.do("POST", "/api/v2/buckets", bucket, nil); err != nil {
+		return fmt.Errorf("Could not create bucket %s: %s", name, err)
+	}
+	logger.Info("Created bucket", "bucket", name, "org", o.org, "duration", o.retentionDuration)
+	return nil
+}
+
+// influxAPI makes requests to the influxdb 2 api, which the influxdb client
+// does not support.
+type influxAPI struct {
+	client *http.Client
+	host   string
+	token  string
+}
+
+// do sends the request with the body encoded as json and decodes the json
+// response into out unless it is nil.
+func (api *influxAPI) do(method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, api.host+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if api.token != "" {
+		req.Header.Set("Authorization", "Token "+api.token)
+	}
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Message == "" {
+			return fmt.Errorf("%s returned %s", path, resp.Status)
+		}
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// databaseExists reports whether the server has a database with the name.
+func databaseExists(client influxdb.Client, name string) (bool, error) {
+	return showContains(client, "SHOW DATABASES", name)
+}
+
+// retentionPolicyExists reports whether the database has a retention
+// policy with the name.
+func retentionPolicyExists(client influxdb.Client, database, name string) (bool, error) {
+	return showContains(client, "SHOW RETENTION POLICIES ON "+quoteIdent(database), name)
+}
+
+// showContains reports whether the first column of the result of a SHOW
+// statement has the name.
+func showContains(client influxdb.Client, stmt, name string) (bool, error) {
+	resp, err := client.Query(influxdb.NewQuery(stmt, "", ""))
+	if err != nil {
+		return false, err
+	} else if err := resp.Error(); err != nil {
+		return false, err
+	}
+	for _, result := range resp.Results {
+		for _, row := range result.Series {
+			for _, values := range row.Values {
+				if len(values) > 0 && values[0] == name {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func query(client influxdb.Client, stmt string) error {
+	resp, err := client.Query(influxdb.NewQuery(stmt, "", ""))
+	if err != nil {
+		return err
+	}
+	return resp.Error()
+}
+
+// quoteIdent quotes an influxql identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(strings.Replace(name, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// quoteString quotes a string literal for an influxql query.
+func quoteString(s string) string {
+	return `'` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `'`, `\'`, -1) + `'`
+}
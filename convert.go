@@ -0,0 +1,777 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// converter converts junit reports into points.
+type converter struct {
+	// measurement is the measurement name template. See expandTemplate.
+	measurement string
+
+	// suiteMeasurement is the measurement name template for the testsuite
+	// summary points. No summaries are written when it is empty.
+	suiteMeasurement string
+
+	// classMeasurement is the measurement name template for the per-class
+	// summary points. No class summaries are written when it is empty.
+	classMeasurement string
+
+	// aggregateOnly skips the testcase points so only the summaries are
+	// written.
+	aggregateOnly bool
+
+	// suiteFilter and testFilter select the testsuites and testcases
+	// that are written.
+	suiteFilter nameFilter
+	testFilter  nameFilter
+
+	// minDuration skips the points for testcases that took less than
+	// this many seconds.
+	minDuration float64
+
+	// sampleRate is the fraction of the testcases that have a point
+	// written. Every testcase is written when it is zero.
+	sampleRate float64
+
+	// suitePercentiles adds duration percentile fields to the testsuite
+	// summaries and suiteHistogram adds a count of the testcases within
+	// each duration bound in seconds.
+	suitePercentiles bool
+	suiteHistogram   []float64
+
+	// tags are added to every point.
+	tags map[string]string
+
+	// fields are added to every point.
+	fields map[string]interface{}
+
+	// tagTemplates and fieldTemplates are evaluated for every point and
+	// added as tags and fields when the result is not empty.
+	tagTemplates   map[string]*template.Template
+	fieldTemplates map[string]*template.Template
+
+	// testID adds the test_id field to the testcase points.
+	testID bool
+
+	// durationScale is the number of duration units in a second and
+	// durationInt writes durations as rounded integers instead of floats.
+	durationScale float64
+	durationInt   bool
+
+	// classNameTag adds the classname tag to the testcase points.
+	classNameTag bool
+
+	// packageTag adds the package tag with the dotted prefix of the
+	// classname to the testcase points. The prefix is limited to
+	// packageDepth components when it is greater than zero.
+	packageTag   bool
+	packageDepth int
+
+	// failureFields adds the failure_message and failure_type fields to
+	// the points of testcases that failed or had an error.
+	failureFields bool
+
+	// timeSource selects how the point timestamps are derived. With
+	// "suite" they are derived from the testsuite timestamp so they are
+	// the same every time a report is written and with "timeline" each
+	// testcase is placed where it ran within the suite. With "mtime" the
+	// modification time of the report is used. Otherwise the current time
+	// is used. See testTime.
+	timeSource      string
+	warnedTimestamp bool
+
+	// timeScope controls how often the current time is read: once per
+	// run, file, or suite. The run time is passed in by the caller.
+	timeScope string
+
+	// statusAs controls whether the testcase status is written as a tag,
+	// a field, or both. The status is not written when it is empty.
+	statusAs string
+
+	// hashTestNames replaces the test_name tag with a hash of the name
+	// for names longer than hashTestNamesOver bytes. The full name is
+	// written to the test_name_full field.
+	hashTestNames     bool
+	hashTestNamesOver int
+
+	// pathTagRules derive tags from the path of each report.
+	pathTagRules []pathTagRule
+
+	// reportFileTag adds the report_file tag with the base name of the
+	// report when it is "base" or the path relative to the working
+	// directory when it is "path".
+	reportFileTag string
+
+	// tagFilter selects the tags that are written. It is applied after
+	// the measurement name has been expanded.
+	tagFilter keyFilter
+
+	// manifest records the testcases in the run so they can be compared
+	// with the previous run. It is nil when no manifest is used.
+	manifest *testManifest
+
+	// mapping replaces the default measurement, tags, and fields of the
+	// testcase and testsuite points when it has a section for them.
+	mapping schemaMapping
+
+	scrubber  scrubber
+	sanitizer tagSanitizer
+	series    seriesGuard
+
+	// run accumulates the totals of every report written by the converter.
+	run runTotals
+
+	// runFields are added to the run summary.
+	runFields map[string]interface{}
+
+	// gates are checked against the run totals once every report has
+	// been written.
+	gates []gateCondition
+
+	// recordDurations keeps the duration of every testcase in the run
+	// totals for the markdown summary.
+	recordDurations bool
+
+	// clusterFailures groups the failures of the run in the run totals.
+	clusterFailures bool
+
+	// points is the number of points written by the converter.
+	points int
+}
+
+// clone returns a copy of the converter with its own tags and an empty
+// run so the copy can write a separate run. The manifest is not copied.
+func (c *converter) clone() *converter {
+	cc := *c
+	cc.tags = make(map[string]string, len(c.tags))
+	for k, v := range c.tags {
+		cc.tags[k] = v
+	}
+	cc.resetRun()
+	cc.points = 0
+	cc.manifest = nil
+	return &cc
+}
+
+// resetRun starts a new run with empty totals and no series, such as for
+// each report of a process that keeps running.
+func (c *converter) resetRun() {
+	c.run = runTotals{}
+	c.series = seriesGuard{warn: c.series.warn, max: c.series.max}
+}
+
+// runTotals holds the totals for a single invocation.
+type runTotals struct {
+	files    int
+	suites   int
+	tests    int
+	failures int
+	errors   int
+	skipped  int
+	duration float64
+
+	// failed lists the testcases that failed or had an error.
+	failed []testKey
+
+	// durations lists the duration of every testcase when the converter
+	// records them.
+	durations []testDuration
+
+	// regressions counts the testcases that were slower than their
+	// baseline.
+	regressions int
+
+	// order records the testsuites to find the first failure of the run.
+	order []suiteOrder
+
+	// clusters groups the failures by their type and normalized message
+	// when the converter clusters them. The keys are in clusterOrder in
+	// the order they were first seen.
+	clusters     map[string]*failureCluster
+	clusterOrder []string
+}
+
+// dropTestcases drops the testcases recorded for the notifications and
+// summaries while keeping the totals and the order of the testsuites.
+func (r *runTotals) dropTestcases() {
+	r.failed = nil
+	r.durations = nil
+	r.clusters = nil
+	r.clusterOrder = nil
+}
+
+// writeTestSuites writes a point for each testcase in the report. The path
+// is the location the report was read from and is empty if the report was
+// not read from a file.
+func (c *converter) writeTestSuites(pw PointsWriter, tests *TestSuites, path string, now time.Time) error {
+	c.run.files++
+	c.scrubber.scrub(tests)
+	fileTags := c.pathTags(path)
+	now = c.fileTime(path, c.scopedNow("file", now))
+	for _, testsuite := range tests.Items {
+		if !c.suiteFilter.match(testsuite.Name) {
+			continue
+		}
+
+		c.run.suites++
+		c.run.tests += testsuite.Tests
+		c.run.failures += testsuite.Failures
+		c.run.errors += testsuite.Errors
+		c.run.skipped += testsuite.Skipped
+		c.run.duration += testsuite.Duration
+
+		suiteTime := c.suiteTime(&testsuite, c.scopedNow("suite", now))
+		if c.suiteMeasurement != "" {
+			if err := c.writeSuiteSummary(pw, &testsuite, fileTags, suiteTime); err != nil {
+				return err
+			}
+		}
+
+		if c.classMeasurement != "" {
+			if err := c.writeClassSummaries(pw, &testsuite, fileTags, suiteTime); err != nil {
+				return err
+			}
+		}
+
+		if c.manifest != nil {
+			for i := range testsuite.TestCases {
+				if c.testFilter.match(testsuite.TestCases[i].Name) {
+					c.manifest.add(&testsuite, &testsuite.TestCases[i])
+				}
+			}
+		}
+
+		c.run.order = append(c.run.order, newSuiteOrder(&testsuite, &c.testFilter))
+		for _, testcase := range testsuite.TestCases {
+			// Excluded tests are left out of the failures and durations
+			// of the run like they are left out of the points.
+			if !c.testFilter.match(testcase.Name) {
+				continue
+			}
+			key := testKey{Suite: testsuite.Name, ClassName: testcase.ClassName, Name: testcase.Name}
+			if testcase.Failure != nil || testcase.Error != nil {
+				c.run.failed = append(c.run.failed, key)
+				if c.clusterFailures {
+					c.run.addFailure(&testsuite, &testcase)
+				}
+			}
+			if c.recordDurations {
+				c.run.durations = append(c.run.durations, testDuration{key: key, seconds: testcase.Duration})
+			}
+		}
+
+		if c.aggregateOnly {
+			continue
+		}
+
+		var elapsed time.Duration
+		for _, testcase := range testsuite.TestCases {
+			ts := c.testTime(suiteTime, elapsed, &testcase)
+			elapsed += testElapsed(&testcase)
+			if err := c.writeTestCase(pw, &testsuite, &testcase, fileTags, ts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeTestCase writes the point for a testcase unless it is filtered out.
+func (c *converter) writeTestCase(pw PointsWriter, testsuite *TestSuite, testcase *TestCase, fileTags map[string]string, ts time.Time) error {
+	if testcase.Duration < c.minDuration || !c.testFilter.match(testcase.Name) {
+		return nil
+	}
+	if c.sampleRate > 0 && !sampled(testsuite, testcase, c.sampleRate) {
+		return nil
+	}
+
+	data := newTemplateData(testsuite, testcase)
+	measurement := c.measurement
+	tags := mergeTags(fileTags, map[string]string{
+		"suite_name": testsuite.Name,
+		"test_name":  testcase.Name,
+	})
+	fields := map[string]interface{}{
+		"duration": c.duration(testcase.Duration),
+	}
+	if pm := c.mapping.testcase; pm != nil {
+		var err error
+		if pm.measurement != "" {
+			measurement = pm.measurement
+		}
+		tags = mergeTags(fileTags, pm.mapTags(testsuite, testcase))
+		if fields, err = pm.mapFields(testsuite, testcase); err != nil {
+			return err
+		}
+	}
+	if c.classNameTag && testcase.ClassName != "" {
+		tags["classname"] = testcase.ClassName
+	}
+	if c.packageTag {
+		if pkg := classPackage(testcase.ClassName, c.packageDepth); pkg != "" {
+			tags["package"] = pkg
+		}
+	}
+	if c.failureFields {
+		f := testcase.Failure
+		if testcase.Error != nil {
+			f = testcase.Error
+		}
+		if f != nil {
+			fields["failure_message"] = f.Message
+			fields["failure_type"] = f.Type
+		}
+	}
+	if c.statusAs != "" {
+		status := testcase.Status()
+		if c.statusAs == "tag" || c.statusAs == "both" {
+			tags["status"] = status
+		}
+		if c.statusAs == "field" || c.statusAs == "both" {
+			fields["status"] = status
+		}
+	}
+	if c.testID {
+		fields["test_id"] = testID(testsuite, testcase)
+	}
+	if testcase.reruns > 0 {
+		fields["reruns"] = testcase.reruns
+	}
+	if c.hashTestNames && len(testcase.Name) > c.hashTestNamesOver {
+		tags["test_name"] = hashString(testcase.Name)
+		fields["test_name_full"] = testcase.Name
+	}
+	return c.writePoint(pw, measurement, data, tags, fields, ts)
+}
+
+// writeSuiteSummary writes the summary point for a testsuite using the
+// totals reported in the testsuite attributes.
+func (c *converter) writeSuiteSummary(pw PointsWriter, testsuite *TestSuite, fileTags map[string]string, now time.Time) error {
+	data := newTemplateData(testsuite, nil)
+	measurement := c.suiteMeasurement
+	tags := mergeTags(fileTags, map[string]string{
+		"suite_name": testsuite.Name,
+	})
+	fields := map[string]interface{}{
+		"tests":    testsuite.Tests,
+		"failures": testsuite.Failures,
+		"errors":   testsuite.Errors,
+		"skipped":  testsuite.Skipped,
+		"duration": c.duration(testsuite.Duration),
+	}
+	addRates(fields, testsuite.Tests, testsuite.Failures, testsuite.Errors, testsuite.Skipped)
+	if pm := c.mapping.suite; pm != nil {
+		var err error
+		if pm.measurement != "" {
+			measurement = pm.measurement
+		}
+		tags = mergeTags(fileTags, pm.mapTags(testsuite, nil))
+		if fields, err = pm.mapFields(testsuite, nil); err != nil {
+			return err
+		}
+	}
+	c.addDurationStats(fields, testsuite)
+	return c.writePoint(pw, measurement, data, tags, fields, now)
+}
+
+// writeClassSummaries writes a summary point for each classname in a
+// testsuite using the totals of its testcases.
+func (c *converter) writeClassSummaries(pw PointsWriter, testsuite *TestSuite, fileTags map[string]string, now time.Time) error {
+	type classTotals struct {
+		tests, failures, errors, skipped int
+		duration                         float64
+	}
+
+	var classes []string
+	totals := make(map[string]*classTotals)
+	for i := range testsuite.TestCases {
+		testcase := &testsuite.TestCases[i]
+		if !c.testFilter.match(testcase.Name) {
+			continue
+		}
+		t, ok := totals[testcase.ClassName]
+		if !ok {
+			t = &classTotals{}
+			totals[testcase.ClassName] = t
+			classes = append(classes, testcase.ClassName)
+		}
+		t.tests++
+		t.duration += testcase.Duration
+		switch testcase.Status() {
+		case "failed":
+			t.failures++
+		case "error":
+			t.errors++
+		case "skipped":
+			t.skipped++
+		}
+	}
+
+	data := newTemplateData(testsuite, nil)
+	for _, className := range classes {
+		t := totals[className]
+		tags := mergeTags(fileTags, map[string]string{
+			"suite_name": testsuite.Name,
+			"classname":  className,
+		})
+		fields := map[string]interface{}{
+			"tests":    t.tests,
+			"failures": t.failures,
+			"errors":   t.errors,
+			"skipped":  t.skipped,
+			"duration": c.duration(t.duration),
+		}
+		if err := c.writePoint(pw, c.classMeasurement, data, tags, fields, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRunSummary writes a single point summarizing every report that has
+// been written by the converter.
+func (c *converter) writeRunSummary(pw PointsWriter, measurement string, now time.Time) error {
+	fields := map[string]interface{}{
+		"files":    c.run.files,
+		"tests":    c.run.tests,
+		"failures": c.run.failures,
+		"errors":   c.run.errors,
+		"skipped":  c.run.skipped,
+		"duration": c.duration(c.run.duration),
+	}
+	addRates(fields, c.run.tests, c.run.failures, c.run.errors, c.run.skipped)
+	if index, elapsed, ok := c.run.firstFailure(); ok {
+		fields["first_failure_index"] = index
+		fields["time_to_first_failure"] = c.duration(elapsed)
+	}
+	for k, v := range c.runFields {
+		fields[k] = v
+	}
+	return c.writePoint(pw, measurement, newTemplateData(nil, nil), nil, fields, now)
+}
+
+// passRate returns the fraction of the testcases that were not skipped that
+// passed. It returns false when every testcase was skipped.
+func passRate(tests, failures, errors, skipped int) (float64, bool) {
+	executed := tests - skipped
+	if executed <= 0 {
+		return 0, false
+	}
+	return float64(executed-failures-errors) / float64(executed), true
+}
+
+// addRates adds the pass_rate and failure_rate fields to a summary so
+// alerts can use them without deriving them in the query. They are left
+// out when every testcase was skipped.
+func addRates(fields map[string]interface{}, tests, failures, errors, skipped int) {
+	if rate, ok := passRate(tests, failures, errors, skipped); ok {
+		fields["pass_rate"] = rate
+		fields["failure_rate"] = 1 - rate
+	}
+}
+
+// writePoint writes a point with the static and templated tags and fields
+// merged underneath the given tags and fields. The measurement is expanded
+// with expandTemplate using the final tags.
+func (c *converter) writePoint(pw PointsWriter, measurement string, data *templateData, tags map[string]string, fields map[string]interface{}, now time.Time) error {
+	allTags := make(map[string]string, len(c.tags)+len(c.tagTemplates)+len(tags))
+	for k, v := range c.tags {
+		allTags[k] = v
+	}
+	for k, tmpl := range c.tagTemplates {
+		v, err := data.execute(tmpl)
+		if err != nil {
+			return fmt.Errorf("Could not evaluate tag %s: %s", k, err)
+		}
+		if v != "" {
+			allTags[k] = v
+		}
+	}
+	for k, v := range tags {
+		allTags[k] = v
+	}
+
+	allFields := make(map[string]interface{}, len(c.fields)+len(c.fieldTemplates)+len(fields))
+	for k, v := range c.fields {
+		allFields[k] = v
+	}
+	for k, tmpl := range c.fieldTemplates {
+		v, err := data.execute(tmpl)
+		if err != nil {
+			return fmt.Errorf("Could not evaluate field %s: %s", k, err)
+		}
+		if v != "" {
+			allFields[k] = parseFieldValue(v)
+		}
+	}
+	for k, v := range fields {
+		allFields[k] = v
+	}
+
+	for k, v := range allTags {
+		if v = c.sanitizer.sanitize(v); v != "" {
+			allTags[k] = v
+		} else {
+			delete(allTags, k)
+		}
+	}
+
+	name, err := expandTemplate(measurement, allTags)
+	if err != nil {
+		return fmt.Errorf("Invalid measurement name: %s", err)
+	}
+	for k := range allTags {
+		if !c.tagFilter.match(k) {
+			delete(allTags, k)
+		}
+	}
+	if err := c.series.add(name, allTags); err != nil {
+		return err
+	}
+
+	pt, err := influxdb.NewPoint(name, allTags, allFields, now)
+	if err != nil {
+		return fmt.Errorf("Could not create point: %s", err)
+	}
+	if err := pw.Write(pt); err != nil {
+		return fmt.Errorf("Could not write point: %s", err)
+	}
+	c.points++
+	return nil
+}
+
+// testID returns a stable identifier for a testcase computed from the
+// suite name, classname, and test name.
+func testID(testsuite *TestSuite, testcase *TestCase) string {
+	return hex.EncodeToString(testHash(testsuite, testcase)[:8])
+}
+
+func testHash(testsuite *TestSuite, testcase *TestCase) []byte {
+	h := sha256.New()
+	io.WriteString(h, testsuite.Name)
+	h.Write([]byte{0})
+	io.WriteString(h, testcase.ClassName)
+	h.Write([]byte{0})
+	io.WriteString(h, testcase.Name)
+	return h.Sum(nil)
+}
+
+// sampled reports whether a testcase is in the sample. The same testcases
+// are chosen on every run so their history is complete.
+func sampled(testsuite *TestSuite, testcase *TestCase, rate float64) bool {
+	n := binary.BigEndian.Uint64(testHash(testsuite, testcase))
+	return float64(n) < rate*(1<<64)
+}
+
+// parseSampleRate parses a sample rate written as a percentage, such as
+// 10%, a ratio, such as 1/20, or a fraction, such as 0.1.
+func parseSampleRate(s string) (float64, error) {
+	var (
+		rate float64
+		err  error
+	)
+	if strings.HasSuffix(s, "%") {
+		rate, err = strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		rate /= 100
+	} else if i := strings.IndexByte(s, '/'); i >= 0 {
+		var num, den float64
+		if num, err = strconv.ParseFloat(s[:i], 64); err == nil {
+			den, err = strconv.ParseFloat(s[i+1:], 64)
+			rate = num / den
+		}
+	} else {
+		rate, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a percentage or ratio", s)
+	} else if !(rate > 0 && rate <= 1) {
+		return 0, fmt.Errorf("%s is not between 0 and 100%%", s)
+	}
+	return rate, nil
+}
+
+// duration converts a duration in seconds to the configured unit and type.
+func (c *converter) duration(seconds float64) interface{} {
+	d := seconds
+	if c.durationScale != 0 {
+		d *= c.durationScale
+	}
+	if c.durationInt {
+		return int64(math.Round(d))
+	}
+	return d
+}
+
+// classPackage returns the package of a classname such as
+// com.example.foo.BarTest, which is everything before the last dot. When
+// depth is greater than zero, only that many components of the package are
+// returned.
+func classPackage(className string, depth int) string {
+	i := strings.LastIndexByte(className, '.')
+	if i < 0 {
+		return ""
+	}
+	pkg := className[:i]
+	if depth > 0 {
+		parts := strings.SplitN(pkg, ".", depth+1)
+		if len(parts) > depth {
+			pkg = strings.Join(parts[:depth], ".")
+		}
+	}
+	return pkg
+}
+
+// hashString returns a short hash of the string.
+func hashString(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:6])
+}
+
+// mergeTags merges the sets of tags in order into a new map.
+func mergeTags(tagSets ...map[string]string) map[string]string {
+	m := make(map[string]string)
+	for _, tags := range tagSets {
+		for k, v := range tags {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// pathTagRule derives a tag from the path of a report.
+type pathTagRule struct {
+	key string
+	re  *regexp.Regexp
+}
+
+// parsePathTagRule parses a rule of the form key=regex. When the regex
+// matches the path, the tag is set to the named group with the same name
+// as the key or, if there is no such group, the first group.
+func parsePathTagRule(s string) (pathTagRule, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return pathTagRule{}, fmt.Errorf("expected key=regex: %s", s)
+	}
+	re, err := regexp.Compile(s[i+1:])
+	if err != nil {
+		return pathTagRule{}, err
+	}
+	if re.NumSubexp() == 0 {
+		return pathTagRule{}, fmt.Errorf("regex has no capture group: %s", s[i+1:])
+	}
+	return pathTagRule{key: s[:i], re: re}, nil
+}
+
+// pathTags returns the tags derived from the path of a report.
+func (c *converter) pathTags(path string) map[string]string {
+	if path == "" || (len(c.pathTagRules) == 0 && c.reportFileTag == "") {
+		return nil
+	}
+
+	tags := make(map[string]string)
+	switch c.reportFileTag {
+	case "base":
+		tags["report_file"] = filepath.Base(path)
+	case "path":
+		rel := path
+		if abs, err := filepath.Abs(path); err == nil {
+			if wd, err := os.Getwd(); err == nil {
+				if r, err := filepath.Rel(wd, abs); err == nil {
+					rel = r
+				}
+			}
+		}
+		tags["report_file"] = filepath.ToSlash(rel)
+	}
+
+	path = filepath.ToSlash(path)
+	for _, rule := range c.pathTagRules {
+		m := rule.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		group := 1
+		if i := rule.re.SubexpIndex(rule.key); i > 0 {
+			group = i
+		}
+		if m[group] != "" {
+			tags[rule.key] = m[group]
+		}
+	}
+	return tags
+}
+
+// parseFieldValue parses a static field value. The type is inferred from
+// the value unless it uses the line protocol conventions of an i suffix
+// for integers or double quotes for strings.
+func parseFieldValue(s string) interface{} {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "i") {
+		if v, err := strconv.ParseInt(s[:len(s)-1], 10, 64); err == nil {
+			return v
+		}
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+// expandTemplate replaces each {name} in the template with the value of
+// the tag with that name or, if there is no such tag, the environment
+// variable with that name.
+func expandTemplate(tmpl string, tags map[string]string) (string, error) {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl, nil
+	}
+
+	var buf strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			buf.WriteString(tmpl)
+			return buf.String(), nil
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated variable in %q", tmpl)
+		}
+		buf.WriteString(tmpl[:i])
+
+		key := tmpl[i+1 : i+j]
+		if v, ok := tags[key]; ok {
+			buf.WriteString(v)
+		} else if v, ok := os.LookupEnv(key); ok {
+			buf.WriteString(v)
+		} else {
+			return "", fmt.Errorf("unknown variable %q", key)
+		}
+		tmpl = tmpl[i+j+1:]
+	}
+}
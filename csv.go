@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// defaultCSVColumns are the columns written when none are specified.
+var defaultCSVColumns = []string{"time", "suite_name", "test_name", "duration"}
+
+// csvPointsWriter writes one row per point. Each column is either the
+// special time or measurement column or the name of a tag or field.
+// Missing values are written as empty cells.
+type csvPointsWriter struct {
+	w       *csv.Writer
+	c       io.Closer
+	columns []string
+	header  bool
+}
+
+func newCSVPointsWriter(w io.WriteCloser, columns []string) *csvPointsWriter {
+	if len(columns) == 0 {
+		columns = defaultCSVColumns
+	}
+	return &csvPointsWriter{
+		w:       csv.NewWriter(w),
+		c:       w,
+		columns: columns,
+	}
+}
+
+func (pw *csvPointsWriter) Write(pt *influxdb.Point) error {
+	if !pw.header {
+		if err := pw.w.Write(pw.columns); err != nil {
+			return err
+		}
+		pw.header = true
+	}
+
+	fields, err := pt.Fields()
+	if err != nil {
+		return err
+	}
+	tags := pt.Tags()
+
+	record := make([]string, len(pw.columns))
+	for i, col := range pw.columns {
+		switch col {
+		case "time":
+			record[i] = pt.Time().UTC().Format(time.RFC3339Nano)
+		case "measurement":
+			record[i] = pt.Name()
+		default:
+			if v, ok := tags[col]; ok {
+				record[i] = v
+			} else if v, ok := fields[col]; ok {
+				record[i] = formatFieldValue(v)
+			}
+		}
+	}
+	return pw.w.Write(record)
+}
+
+func (pw *csvPointsWriter) Flush() error {
+	pw.w.Flush()
+	return pw.w.Error()
+}
+
+func (pw *csvPointsWriter) Close() error {
+	if err := pw.Flush(); err != nil {
+		pw.c.Close()
+		return err
+	}
+	return pw.c.Close()
+}
+
+// formatFieldValue formats a field value without any line protocol
+// type suffixes or quoting.
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+// readDedupReports reads every report and removes the duplicate testcases
+// with the policy. The errors of the reports that could not be read are
+// returned by path.
+func readDedupReports(paths []string, policy string) (map[string]*TestSuites, map[string]error) {
+	reports := make(map[string]*TestSuites, len(paths))
+	errs := make(map[string]error)
+	var all []*TestSuites
+	for _, path := range paths {
+		tests, err := readTestSuitesFile(path)
+		if err != nil {
+			errs[path] = &exitCodeError{code: exitParse, err: err}
+			continue
+		}
+		reports[path] = tests
+		all = append(all, tests)
+	}
+	if n := dedupTestCases(all, policy); n > 0 {
+		logger.Info("Removed duplicate testcases", "count", n, "policy", policy)
+	}
+	return reports, errs
+}
+
+// statusRank orders the statuses of a testcase from the best to the worst
+// for the worst dedup policy.
+var statusRank = map[string]int{"skipped": 0, "passed": 1, "failed": 2, "error": 3}
+
+// testcaseRef is an occurrence of a testcase within the reports of a run.
+type testcaseRef struct {
+	suite *TestSuite
+	index int
+}
+
+func (r testcaseRef) testcase() *TestCase {
+	return &r.suite.TestCases[r.index]
+}
+
+// dedupTestCases removes the testcases that appear in more than one of the
+// reports of a run, such as when the failed tests are retried and written
+// to another report. The testcases are the same when their suite, classname,
+// and name are the same. Testcases with the same name within one report,
+// such as parameterized tests, are all kept or removed together. The policy
+// chooses the report whose occurrences are kept:
+//
+//   - first keeps the occurrences of the first report in order.
+//   - last keeps the last report, which is the final retry.
+//   - worst keeps the report with the worst status so a retry cannot hide
+//     a failure.
+//   - merge keeps the last report and records the number of times the
+//     testcase was rerun in the reruns field of its point.
+//
+// The totals of the testsuites are reduced by the removed testcases and a
+// testsuite that only had duplicates is removed. It returns the number of
+// testcases that were removed.
+func dedupTestCases(reports []*TestSuites, policy string) int {
+	var (
+		keys []testKey
+		// occurrences holds the occurrences of each testcase grouped by
+		// report in the order of the reports.
+		occurrences = make(map[testKey][][]testcaseRef)
+	)
+	for _, report := range reports {
+		seen := make(map[testKey]int)
+		for i := range report.Items {
+			testsuite := &report.Items[i]
+			for j, testcase := range testsuite.TestCases {
+				key := testKey{Suite: testsuite.Name, ClassName: testcase.ClassName, Name: testcase.Name}
+				groups, ok := occurrences[key]
+				if !ok {
+					keys = append(keys, key)
+				}
+				g, ok := seen[key]
+				if !ok {
+					g = len(groups)
+					seen[key] = g
+					groups = append(groups, nil)
+				}
+				groups[g] = append(groups[g], testcaseRef{suite: testsuite, index: j})
+				occurrences[key] = groups
+			}
+		}
+	}
+
+	removed := make(map[*TestSuite]map[int]bool)
+	n := 0
+	for _, key := range keys {
+		groups := occurrences[key]
+		if len(groups) < 2 {
+			continue
+		}
+		keep := len(groups) - 1
+		switch policy {
+		case "first":
+			keep = 0
+		case "worst":
+			keep = 0
+			for i, group := range groups {
+				if worstStatus(group) > worstStatus(groups[keep]) {
+					keep = i
+				}
+			}
+		case "merge":
+			for _, ref := range groups[keep] {
+				ref.testcase().reruns = len(groups) - 1
+			}
+		}
+		for i, group := range groups {
+			if i == keep {
+				continue
+			}
+			for _, ref := range group {
+				if removed[ref.suite] == nil {
+					removed[ref.suite] = make(map[int]bool)
+				}
+				removed[ref.suite][ref.index] = true
+				n++
+			}
+		}
+	}
+
+	for _, report := range reports {
+		items := report.Items[:0]
+		for i := range report.Items {
+			testsuite := report.Items[i]
+			drop := removed[&report.Items[i]]
+			if drop == nil {
+				items = append(items, testsuite)
+				continue
+			}
+			testcases := testsuite.TestCases[:0]
+			for j, testcase := range testsuite.TestCases {
+				if !drop[j] {
+					testcases = append(testcases, testcase)
+					continue
+				}
+				testsuite.Tests--
+				switch testcase.Status() {
+				case "failed":
+					testsuite.Failures--
+				case "error":
+					testsuite.Errors--
+				case "skipped":
+					testsuite.Skipped--
+				}
+			}
+			testsuite.TestCases = testcases
+			if len(testcases) > 0 {
+				items = append(items, clampSuiteTotals(testsuite))
+			}
+		}
+		report.Items = items
+	}
+	return n
+}
+
+// worstStatus returns the rank of the worst status of the occurrences of a
+// testcase in a report.
+func worstStatus(group []testcaseRef) int {
+	worst := 0
+	for _, ref := range group {
+		if rank := statusRank[ref.testcase().Status()]; rank > worst {
+			worst = rank
+		}
+	}
+	return worst
+}
+
+// clampSuiteTotals keeps the totals of a testsuite from going negative when
+// its attributes did not count the removed testcases.
+func clampSuiteTotals(testsuite TestSuite) TestSuite {
+	for _, v := range []*int{&testsuite.Tests, &testsuite.Failures, &testsuite.Errors, &testsuite.Skipped} {
+		if *v < 0 {
+			*v = 0
+		}
+	}
+	return testsuite
+}
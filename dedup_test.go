@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// dedupReports returns a run where TestA failed in the first report and
+// passed when it was retried in the second report.
+func dedupReports() []*TestSuites {
+	return []*TestSuites{
+		{Items: []TestSuite{{
+			Name: "pkg", Tests: 2, Failures: 1,
+			TestCases: []TestCase{
+				{Name: "TestA", Failure: &Failure{Message: "boom"}},
+				{Name: "TestB"},
+			},
+		}}},
+		{Items: []TestSuite{{
+			Name: "pkg", Tests: 1,
+			TestCases: []TestCase{
+				{Name: "TestA"},
+			},
+		}}},
+	}
+}
+
+// describeReports describes each testsuite by its totals and testcases.
+func describeReports(reports []*TestSuites) [][]string {
+	out := make([][]string, len(reports))
+	for i, report := range reports {
+		out[i] = []string{}
+		for _, testsuite := range report.Items {
+			out[i] = append(out[i], fmt.Sprintf("%s tests=%d failures=%d", testsuite.Name, testsuite.Tests, testsuite.Failures))
+			for _, testcase := range testsuite.TestCases {
+				out[i] = append(out[i], fmt.Sprintf("%s %s reruns=%d", testcase.Name, testcase.Status(), testcase.reruns))
+			}
+		}
+	}
+	return out
+}
+
+func TestDedupTestCases(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		removed int
+		want    [][]string
+	}{
+		{
+			policy:  "first",
+			removed: 1,
+			want: [][]string{
+				{"pkg tests=2 failures=1", "TestA failed reruns=0", "TestB passed reruns=0"},
+				{},
+			},
+		},
+		{
+			policy:  "last",
+			removed: 1,
+			want: [][]string{
+				{"pkg tests=1 failures=0", "TestB passed reruns=0"},
+				{"pkg tests=1 failures=0", "TestA passed reruns=0"},
+			},
+		},
+		{
+			policy:  "worst",
+			removed: 1,
+			want: [][]string{
+				{"pkg tests=2 failures=1", "TestA failed reruns=0", "TestB passed reruns=0"},
+				{},
+			},
+		},
+		{
+			policy:  "merge",
+			removed: 1,
+			want: [][]string{
+				{"pkg tests=1 failures=0", "TestB passed reruns=0"},
+				{"pkg tests=1 failures=0", "TestA passed reruns=1"},
+			},
+		},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			reports := dedupReports()
+			if n := dedupTestCases(reports, tt.policy); n != tt.removed {
+				t.Errorf("removed %d testcases, want %d", n, tt.removed)
+			}
+			if got := describeReports(reports); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected reports:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupTestCasesKeepsParameterizedTests(t *testing.T) {
+	// The occurrences with the same name within a report are kept or
+	// removed together.
+	reports := []*TestSuites{
+		{Items: []TestSuite{{Name: "pkg", Tests: 2, TestCases: []TestCase{{Name: "TestP"}, {Name: "TestP"}}}}},
+		{Items: []TestSuite{{Name: "pkg", Tests: 2, TestCases: []TestCase{{Name: "TestP"}, {Name: "TestP", Error: &Failure{}}}}}},
+		{Items: []TestSuite{{Name: "other", Tests: 1, TestCases: []TestCase{{Name: "TestP"}}}}},
+	}
+	if n := dedupTestCases(reports, "worst"); n != 2 {
+		t.Errorf("removed %d testcases, want 2", n)
+	}
+	want := [][]string{
+		{},
+		{"pkg tests=2 failures=0", "TestP passed reruns=0", "TestP error reruns=0"},
+		{"other tests=1 failures=0", "TestP passed reruns=0"},
+	}
+	if got := describeReports(reports); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected reports:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestDedupTestCasesClampsTotals(t *testing.T) {
+	// The totals of a testsuite that did not count its testcases do not
+	// go negative.
+	reports := []*TestSuites{
+		{Items: []TestSuite{{Name: "pkg", TestCases: []TestCase{{Name: "TestA", Failure: &Failure{}}, {Name: "TestB"}}}}},
+		{Items: []TestSuite{{Name: "pkg", TestCases: []TestCase{{Name: "TestA"}}}}},
+	}
+	dedupTestCases(reports, "last")
+	if got := reports[0].Items[0]; got.Tests != 0 || got.Failures != 0 {
+		t.Errorf("got tests=%d failures=%d, want 0", got.Tests, got.Failures)
+	}
+}
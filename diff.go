@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+)
+
+// diffOptions are the options of the diff command.
+type diffOptions struct {
+	log    *logOptions
+	format string
+	output string
+	top    int
+}
+
+func addDiffFlags(fs *pflag.FlagSet) *diffOptions {
+	o := &diffOptions{log: addLogFlags(fs)}
+	fs.StringVar(&o.format, "format", "text", "output format (text, csv, json)")
+	fs.StringVarP(&o.output, "output", "o", "", "write the differences to this file instead of stdout")
+	fs.IntVar(&o.top, "top", 10, "number of the biggest duration changes to list; 0 lists all of them")
+	return o
+}
+
+// readDiffReport reads the status and duration of each testcase in the
+// report by its key.
+func readDiffReport(path string) (map[testKey]*TestCase, error) {
+	report, err := readTestSuitesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tests := make(map[testKey]*TestCase)
+	for i := range report.Items {
+		testsuite := &report.Items[i]
+		for j := range testsuite.TestCases {
+			testcase := &testsuite.TestCases[j]
+			tests[testKey{Suite: testsuite.Name, ClassName: testcase.ClassName, Name: testcase.Name}] = testcase
+		}
+	}
+	return tests, nil
+}
+
+// failing reports whether the status is a failure or an error.
+func failing(status string) bool {
+	return status == "failed" || status == "error"
+}
+
+// diff compares two reports without a database. It lists the testcases
+// that started or stopped failing, the testcases that were added or
+// removed, and the testcases with the biggest changes in duration.
+// Skipped testcases are left out of the duration changes.
+func diff(args []string) {
+	fs := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "diff [options] <old> <new>")
+	o := addDiffFlags(fs)
+	fs.Parse(args)
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+	if fs.NArg() != 2 {
+		logger.Exitf(exitUsage, "Must specify the old and the new report")
+	}
+	switch o.format {
+	case "text", "csv", "json":
+	default:
+		logger.Exitf(exitUsage, "Invalid --format value: %s", o.format)
+	}
+
+	old, err := readDiffReport(fs.Arg(0))
+	if err != nil {
+		logger.Exitf(exitParse, "%s", err)
+	}
+	cur, err := readDiffReport(fs.Arg(1))
+	if err != nil {
+		logger.Exitf(exitParse, "%s", err)
+	}
+
+	keys := make(map[testKey]bool, len(old)+len(cur))
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range cur {
+		keys[key] = true
+	}
+
+	var newlyFailing, newlyPassing, added, removed, durations []testKey
+	for _, key := range sortedTestKeys(keys) {
+		a, b := old[key], cur[key]
+		switch {
+		case a == nil:
+			added = append(added, key)
+		case b == nil:
+			removed = append(removed, key)
+		default:
+			if as, bs := a.Status(), b.Status(); !failing(as) && failing(bs) {
+				newlyFailing = append(newlyFailing, key)
+			} else if failing(as) && bs == "passed" {
+				newlyPassing = append(newlyPassing, key)
+			}
+			if a.Skipped == nil && b.Skipped == nil && a.Duration != b.Duration {
+				durations = append(durations, key)
+			}
+		}
+	}
+	sort.SliceStable(durations, func(i, j int) bool {
+		return math.Abs(cur[durations[i]].Duration-old[durations[i]].Duration) > math.Abs(cur[durations[j]].Duration-old[durations[j]].Duration)
+	})
+	if o.top > 0 && len(durations) > o.top {
+		durations = durations[:o.top]
+	}
+
+	table := &reportTable{columns: []string{"change", "suite", "test", "old_status", "new_status", "old_duration", "new_duration", "delta"}}
+	add := func(change string, keys []testKey) {
+		for _, key := range keys {
+			row := []interface{}{change, key.Suite, key.Name, nil, nil, nil, nil, nil}
+			a, b := old[key], cur[key]
+			if a != nil {
+				row[3], row[5] = a.Status(), a.Duration
+			}
+			if b != nil {
+				row[4], row[6] = b.Status(), b.Duration
+			}
+			if a != nil && b != nil {
+				row[7] = b.Duration - a.Duration
+			}
+			table.add(row...)
+		}
+	}
+	add("newly_failing", newlyFailing)
+	add("newly_passing", newlyPassing)
+	add("added", added)
+	add("removed", removed)
+	add("duration", durations)
+
+	ro := &reportOptions{format: o.format, output: o.output}
+	ro.writeTable(table)
+	if o.format == "text" && o.output == "" {
+		fmt.Fprintf(os.Stdout, "\n%d newly failing, %d newly passing, %d added, %d removed\n", len(newlyFailing), len(newlyPassing), len(added), len(removed))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// downsampleOptions are the options of the downsample command.
+type downsampleOptions struct {
+	conn            *connectionOptions
+	log             *logOptions
+	measurement     string
+	target          string
+	targetRetention string
+	intervals       []string
+	tags            []string
+	language        string
+	bucket          string
+	targetBucket    string
+	apply           bool
+}
+
+func addDownsampleFlags(fs *pflag.FlagSet) *downsampleOptions {
+	o := &downsampleOptions{conn: addQueryFlags(fs), log: addLogFlags(fs)}
+	fs.StringVarP(&o.measurement, "measurement", "m", "junit_test_results", "measurement of the testcase points")
+	fs.StringVar(&o.target, "target-measurement", "junit_suite_rollup", "prefix of the measurements to write the aggregates to; the interval is appended, such as junit_suite_rollup_1h")
+	fs.StringVar(&o.targetRetention, "target-retention-policy", "", "retention policy to write the aggregates to; defaults to the retention policy of the testcase points")
+	fs.StringSliceVar(&o.intervals, "interval", []string{"1h", "1d"}, "intervals to aggregate the testcase points over")
+	fs.StringSliceVar(&o.tags, "group-by", []string{"status"}, "tags to keep in the aggregates in addition to suite_name")
+	fs.StringVar(&o.language, "language", "influxql", "write continuous queries (influxql) or tasks (flux)")
+	fs.StringVar(&o.bucket, "bucket", "", "bucket of the testcase points for flux tasks; defaults to database/retention-policy")
+	fs.StringVar(&o.targetBucket, "target-bucket", "", "bucket to write the aggregates to for flux tasks; defaults to database/target-retention-policy or the bucket of the testcase points")
+	fs.BoolVar(&o.apply, "apply", false, "create the continuous queries on the server instead of printing them")
+	return o
+}
+
+// downsampleAggregates are the fields of the aggregates with the function
+// of the testcase durations that computes them.
+var downsampleAggregates = []struct{ field, fn string }{
+	{"tests", "count"},
+	{"duration", "sum"},
+	{"mean_duration", "mean"},
+	{"max_duration", "max"},
+}
+
+// downsample prints or creates the continuous queries or flux tasks that
+// aggregate the testcase points of each testsuite over each interval so the
+// testcase points can be kept for a shorter time. The aggregates have the
+// number of testcases and their total, mean, and max duration. With the
+// status kept as a tag, the number of failed tests is the tests field of
+// the aggregates with the failed status.
+func downsample(args []string) {
+	fs := pflag.NewFlagSet("downsample", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "downsample [options]")
+	o := addDownsampleFlags(fs)
+	fs.Parse(args)
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+	if o.conn.database == "" && o.bucket == "" {
+		logger.Exitf(exitUsage, "Must specify a database")
+	}
+	for _, interval := range o.intervals {
+		if !influxDurationRE.MatchString(interval) {
+			logger.Exitf(exitUsage, "Invalid --interval value: %s", interval)
+		}
+	}
+
+	var stmts []string
+	switch o.language {
+	case "influxql":
+		for _, interval := range o.intervals {
+			stmts = append(stmts, o.continuousQuery(interval))
+		}
+	case "flux":
+		if o.apply {
+			logger.Exitf(exitUsage, "The --apply option only creates continuous queries; create the flux tasks with the influx cli or ui")
+		}
+		for _, interval := range o.intervals {
+			stmts = append(stmts, o.fluxTask(interval))
+		}
+	default:
+		logger.Exitf(exitUsage, "Invalid --language value: %s", o.language)
+	}
+
+	if !o.apply {
+		fmt.Fprint(os.Stdout, strings.Join(stmts, "\n"))
+		return
+	}
+	client, err := o.conn.newClient()
+	if err != nil {
+		logger.Exitf(exitUsage, "Could not create HTTP client: %s", err)
+	}
+	defer client.Close()
+	for i, stmt := range stmts {
+		if err := query(client, stmt); err != nil {
+			logger.Exitf(exitConnection, "Could not create the continuous query for %s: %s", o.intervals[i], err)
+		}
+		logger.Info("Created continuous query", "name", o.target+"_"+o.intervals[i])
+	}
+}
+
+// groupBy returns the tags that are kept in the aggregates.
+func (o *downsampleOptions) groupBy() []string {
+	tags := []string{"suite_name"}
+	for _, tag := range o.tags {
+		if tag != "" && tag != "suite_name" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// continuousQuery returns the statement that creates the continuous query
+// for the interval.
+func (o *downsampleOptions) continuousQuery(interval string) string {
+	name := o.target + "_" + interval
+	targetRP := o.targetRetention
+	if targetRP == "" {
+		targetRP = o.conn.retentionPolicy
+	}
+	source := qualifiedMeasurement(o.conn.database, o.conn.retentionPolicy, o.measurement)
+	target := qualifiedMeasurement(o.conn.database, targetRP, name)
+
+	var selects []string
+	for _, agg := range downsampleAggregates {
+		selects = append(selects, fmt.Sprintf(`%s("duration") AS %s`, agg.fn, quoteIdent(agg.field)))
+	}
+	groupBy := []string{"time(" + interval + ")"}
+	for _, tag := range o.groupBy() {
+		groupBy = append(groupBy, quoteIdent(tag))
+	}
+	return fmt.Sprintf("CREATE CONTINUOUS QUERY %s ON %s BEGIN SELECT %s INTO %s FROM %s GROUP BY %s END\n",
+		quoteIdent(name), quoteIdent(o.conn.database), strings.Join(selects, ", "), target, source, strings.Join(groupBy, ", "))
+}
+
+// qualifiedMeasurement returns the fully qualified name of a measurement.
+// The default retention policy is used when rp is empty.
+func qualifiedMeasurement(db, rp, measurement string) string {
+	if rp == "" {
+		return quoteIdent(db) + ".." + quoteIdent(measurement)
+	}
+	return quoteIdent(db) + "." + quoteIdent(rp) + "." + quoteIdent(measurement)
+}
+
+// fluxTask returns the flux task for the interval.
+func (o *downsampleOptions) fluxTask(interval string) string {
+	name := o.target + "_" + interval
+	bucket := o.bucket
+	if bucket == "" {
+		bucket = o.conn.database
+		if o.conn.retentionPolicy != "" {
+			bucket += "/" + o.conn.retentionPolicy
+		}
+	}
+	targetBucket := o.targetBucket
+	if targetBucket == "" {
+		targetBucket = bucket
+		if o.targetRetention != "" {
+			targetBucket = o.conn.database + "/" + o.targetRetention
+		}
+	}
+	columns := []string{fluxString("_measurement"), fluxString("_field")}
+	for _, tag := range o.groupBy() {
+		columns = append(columns, fluxString(tag))
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "option task = {name: %s, every: %s}\n\n", fluxString(name), interval)
+	fmt.Fprintf(&buf, "data = from(bucket: %s)\n", fluxString(bucket))
+	buf.WriteString("    |> range(start: -task.every)\n")
+	fmt.Fprintf(&buf, "    |> filter(fn: (r) => r._measurement == %s and r._field == \"duration\")\n", fluxString(o.measurement))
+	fmt.Fprintf(&buf, "    |> group(columns: [%s])\n\n", strings.Join(columns, ", "))
+	buf.WriteString("union(tables: [\n")
+	for _, agg := range downsampleAggregates {
+		fmt.Fprintf(&buf, "    data |> aggregateWindow(every: %s, fn: %s, createEmpty: false) |> set(key: \"_field\", value: %s),\n", interval, agg.fn, fluxString(agg.field))
+	}
+	buf.WriteString("])\n")
+	fmt.Fprintf(&buf, "    |> set(key: \"_measurement\", value: %s)\n", fluxString(name))
+	fmt.Fprintf(&buf, "    |> to(bucket: %s)\n", fluxString(targetBucket))
+	return buf.String()
+}
+
+// fluxString quotes a string literal for flux.
+func fluxString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `${`, `\${`)
+	return `"` + r.Replace(s) + `"`
+}
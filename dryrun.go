@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// dryRunPointsWriter counts the points that would be written and writes a
+// summary of them for each measurement when it is closed.
+type dryRunPointsWriter struct {
+	w            io.Writer
+	precision    string
+	measurements map[string]*dryRunStats
+}
+
+type dryRunStats struct {
+	points int
+	bytes  int
+	series map[string]bool
+}
+
+func newDryRunPointsWriter(w io.Writer, precision string) *dryRunPointsWriter {
+	return &dryRunPointsWriter{
+		w:            w,
+		precision:    precision,
+		measurements: make(map[string]*dryRunStats),
+	}
+}
+
+func (pw *dryRunPointsWriter) Write(pt *influxdb.Point) error {
+	stats, ok := pw.measurements[pt.Name()]
+	if !ok {
+		stats = &dryRunStats{series: make(map[string]bool)}
+		pw.measurements[pt.Name()] = stats
+	}
+	stats.points++
+	stats.bytes += len(pt.PrecisionString(pw.precision)) + 1
+	stats.series[seriesKey(pt.Name(), pt.Tags())] = true
+	return nil
+}
+
+func (pw *dryRunPointsWriter) Flush() error {
+	return nil
+}
+
+// Close writes the summary.
+func (pw *dryRunPointsWriter) Close() error {
+	names := make([]string, 0, len(pw.measurements))
+	for name := range pw.measurements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(pw.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "measurement\tpoints\tseries\tbytes")
+	var points, series, bytes int
+	for _, name := range names {
+		stats := pw.measurements[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", name, stats.points, len(stats.series), stats.bytes)
+		points += stats.points
+		series += len(stats.series)
+		bytes += stats.bytes
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%d\n", points, series, bytes)
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// execOptions are the options of the exec command in addition to the ingest
+// options.
+type execOptions struct {
+	reports []string
+}
+
+func addExecFlags(fs *pflag.FlagSet) *execOptions {
+	o := &execOptions{}
+	fs.StringArrayVar(&o.reports, "report", nil, "glob matching the reports written by the command (may be repeated)")
+	return o
+}
+
+// execCommand runs a test command, writes the points for the reports it
+// produced along with its exit code and duration in the run summary, and
+// exits with the exit code of the command. The reports are written even
+// when the command fails.
+func execCommand(args []string) {
+	fs := pflag.NewFlagSet("exec", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "exec --report <glob> [options] [--] <command> [args]...")
+	o := newIngestOptions(fs)
+	eo := addExecFlags(fs)
+	// The options end at the command so the options of the command, such
+	// as go test -v, are passed to it without needing --.
+	fs.SetInterspersed(false)
+	fs.Parse(args)
+
+	argv := fs.Args()
+	if len(argv) == 0 {
+		logger.Exitf(exitUsage, "Must specify a command to run")
+	} else if len(eo.reports) == 0 {
+		logger.Exitf(exitUsage, "Must specify the reports written by the command with --report")
+	}
+
+	start := time.Now()
+	status := runCommand(argv)
+	elapsed := time.Since(start)
+	logger.Info("Ran command", "command", argv[0], "exit_code", status, "elapsed", elapsed)
+
+	// The exit code of the command takes precedence over the exit code
+	// of the ingestion so a failing test run still fails the build.
+	exit = func(code int) {
+		if status != 0 {
+			code = status
+		}
+		os.Exit(code)
+	}
+
+	// Reports left over from an earlier run would be written again, so
+	// only the ones modified since the command started are used.
+	var files []string
+	for _, pattern := range eo.reports {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --report value: %s", err)
+		}
+		for _, path := range matches {
+			if fi, err := os.Stat(path); err == nil && !fi.ModTime().Before(start.Truncate(time.Second)) {
+				files = append(files, path)
+			}
+		}
+	}
+	if len(files) == 0 {
+		logger.Exitf(exitParse, "The command did not write any reports matching --report")
+	}
+
+	runIngest(fs, o, files, map[string]interface{}{
+		"command_exit_code": status,
+		"command_duration":  elapsed.Seconds(),
+	})
+	exit(0)
+}
+
+// runCommand runs the command with the standard streams of the tool and
+// returns its exit code. Interrupts are forwarded to the command so it can
+// finish writing its reports.
+func runCommand(argv []string) int {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		logger.Errorf("Could not run %s: %s", argv[0], err)
+		return 127
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		logger.Errorf("Could not run %s: %s", argv[0], err)
+		return exitFailure
+	}
+	return 0
+}
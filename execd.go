@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// runTelegrafExecd implements the telegraf execd input contract. Each line
+// read from r is either the path to a report or the start of a raw xml
+// report which continues until the closing testsuites element. The points
+// for each report are written to w as line protocol as soon as the report
+// has been read. Empty lines, which telegraf sends when it is configured
+// to signal through stdin, are ignored.
+//
+// Errors with individual reports are logged to stderr so the process keeps
+// running; only an error reading from r stops it. The timestamps are
+// written in the precision.
+func runTelegrafExecd(c *converter, r io.Reader, w io.Writer, precision string) error {
+	pw := &printPointsWriter{w: w, precision: precision}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var (
+			tests *TestSuites
+			path  string
+			err   error
+		)
+		if strings.HasPrefix(line, "<") {
+			var buf bytes.Buffer
+			buf.WriteString(line)
+			for !strings.Contains(line, "</testsuites>") && scanner.Scan() {
+				line = scanner.Text()
+				buf.WriteByte('\n')
+				buf.WriteString(line)
+			}
+			tests, err = decodeTestSuites(&buf)
+			if err != nil {
+				logger.Errorf("Unable to decode report: %s", err)
+				continue
+			}
+		} else {
+			path = line
+			tests, err = readTestSuitesFile(path)
+			if err != nil {
+				logger.Errorf("%s", err)
+				continue
+			}
+		}
+
+		if err := c.writeTestSuites(pw, tests, path, time.Now()); err != nil {
+			logger.Errorf("%s", err)
+		}
+		// Each report is a run of its own so the process does not keep
+		// the testcases and series of every report it has read.
+		c.resetRun()
+	}
+	return scanner.Err()
+}
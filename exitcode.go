@@ -0,0 +1,51 @@
+package main
+
+// The exit codes of the tool. Scripts can use them to tell a report that
+// could not be read apart from a server that could not be reached.
+const (
+	// exitFailure is used for errors that do not have a more specific
+	// exit code.
+	exitFailure = 1
+
+	// exitUsage is used when the options or config file are invalid.
+	exitUsage = 2
+
+	// exitParse is used when a report could not be read or converted.
+	// The points of the other reports were written.
+	exitParse = 3
+
+	// exitConnection is used when no points could be written to the
+	// server.
+	exitConnection = 4
+
+	// exitPartialWrite is used when some of the points were written to
+	// the server but others could not be.
+	exitPartialWrite = 5
+
+	// exitGate is used when the points were written but the run failed
+	// one of the --fail-if conditions.
+	exitGate = 6
+
+	// exitSeriesLimit is used when the run stopped because it would have
+	// written more than --max-series series. The reports before the one
+	// that crossed the limit were written.
+	exitSeriesLimit = 7
+)
+
+// exitCodeError is an error with the exit code it should cause.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+// exitCode returns the exit code for an error.
+func exitCode(err error) int {
+	if e, ok := err.(*exitCodeError); ok {
+		return e.code
+	}
+	return exitFailure
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// fetchOptions are the options of the fetch command in addition to the
+// ingest options.
+type fetchOptions struct {
+	gitlabToken     string
+	gitlabURL       string
+	artifactPattern string
+	maxSize         string
+}
+
+func addFetchFlags(fs *pflag.FlagSet) *fetchOptions {
+	o := &fetchOptions{}
+	fs.StringVar(&o.gitlabToken, "gitlab-token", "", "gitlab token used to download the artifacts of pipelines; defaults to the GITLAB_TOKEN environment variable")
+	fs.StringVar(&o.gitlabURL, "gitlab-url", "https://gitlab.com", "url of the gitlab server")
+	fs.StringVar(&o.artifactPattern, "artifact-pattern", "*.xml", "glob matching the file name of the reports within the artifacts")
+	fs.StringVar(&o.maxSize, "max-artifact-size", "64MB", "largest artifact archive and report to download, such as 512KB or 64MB (0 for no limit)")
+	return o
+}
+
+// fetchedRun is a ci run whose artifacts were downloaded.
+type fetchedRun struct {
+	branch, commit, buildNumber, workflow string
+}
+
+// fetch downloads the reports in the artifacts of a github actions workflow
+// run or of the jobs of a gitlab pipeline and writes their points like
+// ingest. The branch, commit, and build number of the run are added as
+// tags in place of the ones detected from the environment, which belong to
+// the job running fetch rather than to the fetched run.
+func fetch(args []string) {
+	fs := pflag.NewFlagSet("fetch", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "fetch [options] github <owner/repo> <run-id>\n       influx-junit fetch [options] gitlab <project> <pipeline-id>")
+	o := newIngestOptions(fs)
+	fo := addFetchFlags(fs)
+	fs.Parse(args)
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+
+	if fs.NArg() != 3 {
+		logger.Exitf(exitUsage, "Must specify the provider, the project, and the id of the run")
+	} else if *o.stream || *o.telegrafExecd {
+		logger.Exitf(exitUsage, "The fetch command cannot read from stdin")
+	}
+	provider, project := fs.Arg(0), fs.Arg(1)
+	if provider != "github" && provider != "gitlab" {
+		logger.Exitf(exitUsage, "Unknown provider: %s (github or gitlab)", provider)
+	}
+	id, err := strconv.ParseInt(fs.Arg(2), 10, 64)
+	if err != nil {
+		logger.Exitf(exitUsage, "Invalid run id: %s", fs.Arg(2))
+	}
+	if _, err := filepath.Match(fo.artifactPattern, ""); err != nil {
+		logger.Exitf(exitUsage, "Invalid --artifact-pattern value: %s", err)
+	}
+	limit, err := parseByteSize(fo.maxSize)
+	if err != nil {
+		logger.Exitf(exitUsage, "Invalid --max-artifact-size value: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "influx-junit-fetch")
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	// runIngest exits instead of returning, so the reports are removed
+	// when it does.
+	exit = func(code int) {
+		os.RemoveAll(dir)
+		os.Exit(code)
+	}
+
+	d := &artifactDownloader{client: &http.Client{}, dir: dir, pattern: fo.artifactPattern, limit: limit}
+	var run *fetchedRun
+	switch provider {
+	case "github":
+		token := *o.githubToken
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		run, err = d.fetchGitHubRun(newGitHubAPI(d.client, token), project, id)
+	case "gitlab":
+		token := fo.gitlabToken
+		if token == "" {
+			token = os.Getenv("GITLAB_TOKEN")
+		}
+		api := &gitlabAPI{client: d.client, baseURL: strings.TrimSuffix(fo.gitlabURL, "/"), token: token}
+		run, err = d.fetchGitLabPipeline(api, project, id)
+	}
+	if err != nil {
+		logger.Exitf(exitConnection, "Could not download the artifacts of %s run %d: %s", project, id, err)
+	} else if len(d.files) == 0 {
+		logger.Exitf(exitParse, "No reports matching %s in the artifacts of %s run %d", fo.artifactPattern, project, id)
+	}
+	logger.Info("Downloaded reports", "project", project, "run", id, "reports", len(d.files))
+
+	*o.noCITags, *o.gitTags = true, false
+	runTags := []string{"branch=" + run.branch, "commit=" + run.commit, "build_number=" + run.buildNumber}
+	if run.workflow != "" {
+		runTags = append(runTags, "workflow="+run.workflow)
+	}
+	// Added first so they can be overridden with --tag.
+	*o.tags = append(runTags, *o.tags...)
+	runIngest(fs, o, d.files, nil)
+	exit(0)
+}
+
+// artifactDownloader stores the reports found in artifact archives in a
+// directory.
+type artifactDownloader struct {
+	client  *http.Client
+	dir     string
+	pattern string
+	limit   int64
+
+	// files are the paths of the stored reports.
+	files []string
+}
+
+// download stores the reports in the artifact archive downloaded by the
+// request. Each report may not be larger than the limit once decompressed.
+func (d *artifactDownloader) download(req *http.Request) error {
+	return readArtifacts(d.client, req, d.pattern, d.limit, func(name string, r io.Reader) error {
+		path := filepath.Join(d.dir, fmt.Sprintf("%03d-%s", len(d.files), filepath.Base(name)))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, newUploadBudget(d.limit).reader(r))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("report %s is larger than %d bytes", name, d.limit)
+		} else if err != nil {
+			return err
+		}
+		d.files = append(d.files, path)
+		return nil
+	})
+}
+
+// fetchGitHubRun stores the reports in the artifacts of a workflow run.
+func (d *artifactDownloader) fetchGitHubRun(api *githubAPI, repo string, runID int64) (*fetchedRun, error) {
+	var run struct {
+		Name       string `json:"name"`
+		RunNumber  int64  `json:"run_number"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+	}
+	if err := api.do("GET", fmt.Sprintf("/repos/%s/actions/runs/%d", repo, runID), nil, &run); err != nil {
+		return nil, err
+	}
+	artifacts, err := api.runArtifacts(repo, runID)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		req, err := api.artifactRequest(artifact)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.download(req); err != nil {
+			return nil, fmt.Errorf("artifact %s: %s", artifact.Name, err)
+		}
+	}
+	return &fetchedRun{
+		branch:      run.HeadBranch,
+		commit:      run.HeadSHA,
+		buildNumber: fmt.Sprint(run.RunNumber),
+		workflow:    run.Name,
+	}, nil
+}
+
+// gitlabAPI sends requests to the rest api of a gitlab server.
+type gitlabAPI struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// request returns a request for the path of the api.
+func (api *gitlabAPI) request(path string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", api.baseURL+"/api/v4"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if api.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", api.token)
+	}
+	return req, nil
+}
+
+// get decodes the json response of the path into out.
+func (api *gitlabAPI) get(path string, out interface{}) error {
+	req, err := api.request(path)
+	if err != nil {
+		return err
+	}
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("gitlab returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// fetchGitLabPipeline stores the reports in the artifacts of the jobs of a
+// pipeline. The project is its id or its path, such as group/project.
+func (d *artifactDownloader) fetchGitLabPipeline(api *gitlabAPI, project string, pipelineID int64) (*fetchedRun, error) {
+	base := fmt.Sprintf("/projects/%s/pipelines/%d", url.PathEscape(project), pipelineID)
+	var pipeline struct {
+		IID int64  `json:"iid"`
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if err := api.get(base, &pipeline); err != nil {
+		return nil, err
+	}
+	var jobs []struct {
+		ID            int64 `json:"id"`
+		ArtifactsFile *struct {
+			Filename string `json:"filename"`
+		} `json:"artifacts_file"`
+	}
+	if err := api.get(base+"/jobs?per_page=100", &jobs); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ArtifactsFile == nil || job.ArtifactsFile.Filename == "" {
+			continue
+		}
+		req, err := api.request(fmt.Sprintf("/projects/%s/jobs/%d/artifacts", url.PathEscape(project), job.ID))
+		if err != nil {
+			return nil, err
+		}
+		if err := d.download(req); err != nil {
+			return nil, fmt.Errorf("job %d: %s", job.ID, err)
+		}
+	}
+	return &fetchedRun{
+		branch:      pipeline.Ref,
+		commit:      pipeline.SHA,
+		buildNumber: fmt.Sprint(pipeline.IID),
+	}, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import "regexp"
+
+// nameFilter matches names against include and exclude patterns. A name
+// matches when it matches any of the include patterns, or there are none,
+// and it does not match any of the exclude patterns.
+type nameFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newNameFilter(include, exclude []string) (nameFilter, error) {
+	var f nameFilter
+	for _, expr := range include {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nameFilter{}, err
+		}
+		f.include = append(f.include, re)
+	}
+	for _, expr := range exclude {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nameFilter{}, err
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+func (f *nameFilter) match(name string) bool {
+	if len(f.include) > 0 {
+		matched := false
+		for _, re := range f.include {
+			if re.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyFilter selects tag keys by name. A key is selected when it is in the
+// include set, or the include set is empty, and it is not in the exclude
+// set.
+type keyFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+func newKeyFilter(include, exclude []string) keyFilter {
+	var f keyFilter
+	if len(include) > 0 {
+		f.include = make(map[string]bool, len(include))
+		for _, k := range include {
+			f.include[k] = true
+		}
+	}
+	if len(exclude) > 0 {
+		f.exclude = make(map[string]bool, len(exclude))
+		for _, k := range exclude {
+			f.exclude[k] = true
+		}
+	}
+	return f
+}
+
+func (f *keyFilter) match(key string) bool {
+	if f.include != nil && !f.include[key] {
+		return false
+	}
+	return !f.exclude[key]
+}
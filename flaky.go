@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+)
+
+// flakyOptions are the options of the flaky report.
+type flakyOptions struct {
+	*reportOptions
+	minRuns int
+	top     int
+}
+
+func addFlakyFlags(fs *pflag.FlagSet, top int) *flakyOptions {
+	o := &flakyOptions{reportOptions: addReportFlags(fs)}
+	fs.IntVar(&o.minRuns, "min-runs", 5, "only rank the testcases with at least this many runs that were not skipped")
+	fs.IntVar(&o.top, "top", top, "number of testcases to list; 0 lists all of them")
+	return o
+}
+
+// flakyTest holds the results of a testcase within the window of the
+// report.
+type flakyTest struct {
+	suite, name string
+	runs        int
+	failures    int
+
+	// flips counts the changes between passing and failing in the results
+	// of each branch ordered by time.
+	flips int
+
+	// branches holds whether the last result of each branch failed and
+	// commits whether each commit has passing and failing results.
+	branches map[string]bool
+	commits  map[string]*[2]bool
+}
+
+// flakyCommits returns the number of commits that both passed and failed.
+func (t *flakyTest) flakyCommits() int {
+	n := 0
+	for _, c := range t.commits {
+		if c[0] && c[1] {
+			n++
+		}
+	}
+	return n
+}
+
+// score returns the fraction of the results that changed status from the
+// previous result of the same branch.
+func (t *flakyTest) score() float64 {
+	if transitions := t.runs - len(t.branches); transitions > 0 {
+		return float64(t.flips) / float64(transitions)
+	}
+	return 0
+}
+
+// reportFlaky ranks the testcases whose status flips between passing and
+// failing. A test that fails and passes on the same commit is the clearest
+// sign of a flaky test, so those are ranked first and the rest by how often
+// the status changes from one run to the next on the same branch. The
+// testcase points must have the status as a tag or field, such as with
+// --status-as or --schema v2.
+func reportFlaky(args []string) {
+	fs := pflag.NewFlagSet("report flaky", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "report flaky [options]")
+	o := addFlakyFlags(fs, 20)
+	fs.Parse(args)
+	o.validate(fs)
+
+	table := &reportTable{columns: []string{"suite", "test", "runs", "failures", "flips", "flaky_commits", "score"}}
+	for _, t := range queryFlakyTests(o) {
+		table.add(t.suite, t.name, t.runs, t.failures, t.flips, t.flakyCommits(), t.score())
+	}
+	o.writeTable(table)
+}
+
+// queryFlakyTests reads the results within the window of the report and
+// returns the flaky testcases from the most flaky to the least.
+func queryFlakyTests(o *flakyOptions) []*flakyTest {
+	client := o.connect()
+	defer client.Close()
+
+	stmt := fmt.Sprintf(`SELECT "duration", "status", "commit", "branch" FROM %s WHERE %s GROUP BY "suite_name", "test_name"`, o.source(), o.where())
+	tests := make(map[[2]string]*flakyTest)
+	hasStatus := false
+	err := queryRows(client, o.conn.database, stmt, func(tags map[string]string, values map[string]interface{}) {
+		status, _ := values["status"].(string)
+		if status == "" {
+			return
+		}
+		hasStatus = true
+		if status == "skipped" {
+			return
+		}
+
+		key := [2]string{tags["suite_name"], tags["test_name"]}
+		t, ok := tests[key]
+		if !ok {
+			t = &flakyTest{
+				suite:    key[0],
+				name:     key[1],
+				branches: make(map[string]bool),
+				commits:  make(map[string]*[2]bool),
+			}
+			tests[key] = t
+		}
+		failed := status == "failed" || status == "error"
+		t.runs++
+		if failed {
+			t.failures++
+		}
+
+		branch, _ := values["branch"].(string)
+		if prev, ok := t.branches[branch]; ok && prev != failed {
+			t.flips++
+		}
+		t.branches[branch] = failed
+
+		if commit, _ := values["commit"].(string); commit != "" {
+			c, ok := t.commits[commit]
+			if !ok {
+				c = new([2]bool)
+				t.commits[commit] = c
+			}
+			if failed {
+				c[1] = true
+			} else {
+				c[0] = true
+			}
+		}
+	})
+	if err != nil {
+		logger.Exitf(exitConnection, "Could not query the results: %s", err)
+	}
+	if len(tests) == 0 && !hasStatus {
+		logger.Warnf("No results with a status in %s; write the points with --status-as or --schema v2", o.measurement)
+	}
+
+	var flaky []*flakyTest
+	for _, t := range tests {
+		if t.runs >= o.minRuns && (t.flips > 0 || t.flakyCommits() > 0) {
+			flaky = append(flaky, t)
+		}
+	}
+	sort.Slice(flaky, func(i, j int) bool {
+		a, b := flaky[i], flaky[j]
+		if ac, bc := a.flakyCommits(), b.flakyCommits(); ac != bc {
+			return ac > bc
+		}
+		if as, bs := a.score(), b.score(); as != bs {
+			return as > bs
+		}
+		if a.suite != b.suite {
+			return a.suite < b.suite
+		}
+		return a.name < b.name
+	})
+	if o.top > 0 && len(flaky) > o.top {
+		flaky = flaky[:o.top]
+	}
+	return flaky
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gateCondition fails the run when a metric of the run totals compares to
+// the value with the operator, such as failures>0 or pass_rate<0.98.
+type gateCondition struct {
+	expr   string
+	metric string
+	op     string
+	value  float64
+}
+
+// gateOperators lists the comparison operators with the two character ones
+// first so they are matched before their prefixes.
+var gateOperators = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// gateMetrics lists the metrics of the run totals that gates can check.
+var gateMetrics = []string{"tests", "passed", "failures", "errors", "failed", "skipped", "pass_rate", "failure_rate", "duration", "files", "regressions"}
+
+// parseGateCondition parses a condition such as failures>0. The metric is
+// one of gateMetrics and the duration is in seconds.
+func parseGateCondition(s string) (gateCondition, error) {
+	for _, op := range gateOperators {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		g := gateCondition{
+			expr:   s,
+			metric: strings.TrimSpace(s[:i]),
+			op:     op,
+		}
+		known := false
+		for _, name := range gateMetrics {
+			known = known || name == g.metric
+		}
+		if !known {
+			return gateCondition{}, fmt.Errorf("unknown metric %q; expected one of %s", g.metric, strings.Join(gateMetrics, ", "))
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s[i+len(op):]), 64)
+		if err != nil {
+			return gateCondition{}, fmt.Errorf("invalid value in %q", s)
+		}
+		g.value = v
+		return g, nil
+	}
+	return gateCondition{}, fmt.Errorf("expected <metric><operator><value>: %s", s)
+}
+
+// metric returns the value of a metric of the run. The rates are not
+// defined when every testcase was skipped.
+func (r *runTotals) metric(name string) (float64, bool) {
+	executed := r.tests - r.skipped
+	switch name {
+	case "tests":
+		return float64(r.tests), true
+	case "passed":
+		return float64(executed - r.failures - r.errors), true
+	case "failures":
+		return float64(r.failures), true
+	case "errors":
+		return float64(r.errors), true
+	case "failed":
+		return float64(r.failures + r.errors), true
+	case "skipped":
+		return float64(r.skipped), true
+	case "pass_rate":
+		return passRate(r.tests, r.failures, r.errors, r.skipped)
+	case "failure_rate":
+		rate, ok := passRate(r.tests, r.failures, r.errors, r.skipped)
+		return 1 - rate, ok
+	case "duration":
+		return r.duration, true
+	case "files":
+		return float64(r.files), true
+	case "regressions":
+		return float64(r.regressions), true
+	}
+	return 0, false
+}
+
+// matches returns whether the run fails the gate and the value of the
+// metric. Conditions on a metric that is not defined for the run never
+// match.
+func (g gateCondition) matches(r *runTotals) (bool, float64) {
+	v, ok := r.metric(g.metric)
+	if !ok {
+		logger.Warnf("Cannot check --fail-if %s: no testcases were run", g.expr)
+		return false, 0
+	}
+	switch g.op {
+	case ">":
+		return v > g.value, v
+	case ">=":
+		return v >= g.value, v
+	case "<":
+		return v < g.value, v
+	case "<=":
+		return v <= g.value, v
+	case "!=":
+		return v != g.value, v
+	default:
+		return v == g.value, v
+	}
+}
+
+// checkGates exits with exitGate when the totals of the run match any of
+// the gates of the converter. Every matching gate is logged first.
+func checkGates(c *converter) {
+	failed := 0
+	for _, g := range c.gates {
+		if ok, v := g.matches(&c.run); ok {
+			logger.Errorf("Failed --fail-if %s: %s is %g", g.expr, g.metric, v)
+			failed++
+		}
+	}
+	if failed > 0 {
+		logger.Exitf(exitGate, "The run failed %d of %d quality gates", failed, len(c.gates))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseGateCondition(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    gateCondition
+		wantErr bool
+	}{
+		{s: "failures>0", want: gateCondition{metric: "failures", op: ">", value: 0}},
+		{s: "pass_rate < 0.98", want: gateCondition{metric: "pass_rate", op: "<", value: 0.98}},
+		{s: "duration>=600", want: gateCondition{metric: "duration", op: ">=", value: 600}},
+		{s: "errors!=0", want: gateCondition{metric: "errors", op: "!=", value: 0}},
+		{s: "tests==10", want: gateCondition{metric: "tests", op: "==", value: 10}},
+		{s: "skipped=3", want: gateCondition{metric: "skipped", op: "=", value: 3}},
+		{s: "failures", wantErr: true},
+		{s: "flakes>0", wantErr: true},
+		{s: "failures>many", wantErr: true},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseGateCondition(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.expr = tt.s
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
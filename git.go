@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// detectGit returns the commit and branch tags and the dirty field for the
+// git repository containing the working directory. It is used for local
+// runs where there is no CI metadata.
+func detectGit() (map[string]string, map[string]interface{}, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	workTree, gitDir, err := findGitDir(wd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	head, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return nil, nil, err
+	}
+	tags := make(map[string]string)
+	ref := strings.TrimSpace(string(head))
+	if strings.HasPrefix(ref, "ref: ") {
+		ref = strings.TrimPrefix(ref, "ref: ")
+		tags["branch"] = strings.TrimPrefix(ref, "refs/heads/")
+		if sha := resolveGitRef(gitDir, ref); sha != "" {
+			tags["commit"] = sha
+		}
+	} else if ref != "" {
+		// A detached HEAD contains the commit itself.
+		tags["commit"] = ref
+	}
+
+	// Whether the work tree has changes cannot be read without comparing
+	// it to the index, so it is left to the git command when it is
+	// installed.
+	fields := make(map[string]interface{})
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = workTree
+	if out, err := cmd.Output(); err == nil {
+		fields["dirty"] = len(bytes.TrimSpace(out)) > 0
+	}
+	return tags, fields, nil
+}
+
+// findGitDir walks up from dir to find the root of the work tree and its
+// git directory. The .git entry may be a file pointing to the git
+// directory of a worktree or submodule.
+func findGitDir(dir string) (workTree, gitDir string, err error) {
+	for {
+		path := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(path); err == nil {
+			if fi.IsDir() {
+				return dir, path, nil
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", "", err
+			}
+			line := strings.TrimSpace(string(data))
+			if !strings.HasPrefix(line, "gitdir: ") {
+				return "", "", errors.New("invalid .git file")
+			}
+			gitDir = strings.TrimPrefix(line, "gitdir: ")
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return dir, gitDir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", errors.New("not a git repository")
+		}
+		dir = parent
+	}
+}
+
+// resolveGitRef returns the commit a ref points to from the loose refs or
+// the packed refs. Worktrees keep their refs in the common git directory.
+func resolveGitRef(gitDir, ref string) string {
+	dirs := []string{gitDir}
+	if common, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		dir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(gitDir, dir)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+		f, err := os.Open(filepath.Join(dir, "packed-refs"))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[1] == ref {
+				f.Close()
+				return fields[0]
+			}
+		}
+		f.Close()
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	ingestpb "github.com/jsternberg/influx-junit/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testResultBatch is the number of test results of a stream that are
+// written together.
+const testResultBatch = 500
+
+// ingestService serves the Ingest service of proto/ingest.proto. The calls
+// are authorized, limited, and written the same way as the uploads to
+// /ingest.
+type ingestService struct {
+	ingestpb.UnimplementedIngestServer
+	s *server
+}
+
+// newGRPCServer returns a grpc server with the Ingest service. It serves
+// tls when tlsConfig is set.
+func (s *server) newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	// The reports of a call are within a single message, so the messages
+	// have the same limit as an upload.
+	maxMsgSize := math.MaxInt32
+	if s.maxUpload > 0 && s.maxUpload < math.MaxInt32 {
+		maxMsgSize = int(s.maxUpload)
+	}
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(maxMsgSize)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	gs := grpc.NewServer(opts...)
+	ingestpb.RegisterIngestServer(gs, &ingestService{s: s})
+	return gs
+}
+
+// stopGRPC stops accepting calls and waits for the calls in progress until
+// the context is done, when they are dropped.
+func (s *server) stopGRPC(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// authorize checks that the call may write the reports of the project with
+// the authorization metadata of the call in place of the Authorization
+// header of an upload. It returns the project, which is the project of the
+// token when it is left out.
+func (svc *ingestService) authorize(ctx context.Context, project string) (string, error) {
+	s := svc.s
+	r := &http.Request{Header: make(http.Header)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			r.Header.Add("Authorization", v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	if project == "" {
+		project = s.tokenProject(r)
+	}
+	if !s.authorized(r, project) {
+		logger.Debug("Rejected upload", "project", project, "remote", r.RemoteAddr)
+		return "", status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	if project == "" {
+		return "", status.Error(codes.InvalidArgument, "Must specify a project")
+	}
+	if s.limiter != nil {
+		if ok, wait := s.limiter.allow(s.clientKey(r, project), time.Now()); !ok {
+			return "", status.Errorf(codes.ResourceExhausted, "Too many uploads, retry in %s", wait.Round(time.Second))
+		}
+	}
+	return project, nil
+}
+
+// decodeReport decodes a report that may be gzip compressed. The budget
+// limits the size of the decompressed report.
+func (svc *ingestService) decodeReport(report *ingestpb.Report, budget *uploadBudget) (*TestSuites, error) {
+	tests, err := decodeUpload(bytes.NewReader(report.GetContent()), budget)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, status.Errorf(codes.ResourceExhausted, "Upload is larger than %d bytes", svc.s.maxUpload)
+		}
+		svc.s.metrics.addParseError()
+		if report.GetName() != "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Unable to decode report %s: %s", report.GetName(), err)
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "Unable to decode report: %s", err)
+	}
+	return tests, nil
+}
+
+// write writes the reports with server.writeReports and adds the totals to
+// the result.
+func (svc *ingestService) write(project string, reports []*TestSuites, result *ingestpb.IngestResult) error {
+	code, resp, err := svc.s.writeReports(project, reports, nil)
+	if err != nil {
+		c := codes.Internal
+		switch code {
+		case http.StatusBadRequest:
+			c = codes.InvalidArgument
+		case http.StatusBadGateway:
+			c = codes.Unavailable
+		}
+		return status.Error(c, err.Error())
+	}
+	result.Project = resp.Project
+	result.Reports += int64(resp.Reports)
+	result.Tests += int64(resp.Tests)
+	result.Failures += int64(resp.Failures)
+	result.Errors += int64(resp.Errors)
+	result.Skipped += int64(resp.Skipped)
+	result.Points += int64(resp.Points)
+	result.Queued = result.Queued || resp.Queued
+	return nil
+}
+
+// SubmitReports converts and writes the reports of the request. The points
+// are only written if every report can be converted.
+func (svc *ingestService) SubmitReports(ctx context.Context, req *ingestpb.SubmitReportsRequest) (*ingestpb.IngestResult, error) {
+	project, err := svc.authorize(ctx, req.GetProject())
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetReports()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No reports were uploaded")
+	}
+
+	budget := newUploadBudget(svc.s.maxUpload)
+	reports := make([]*TestSuites, 0, len(req.GetReports()))
+	for _, report := range req.GetReports() {
+		tests, err := svc.decodeReport(report, budget)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, tests)
+	}
+
+	result := &ingestpb.IngestResult{}
+	if err := svc.write(project, reports, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StreamReports writes each report as it is received. The project is read
+// from the first report and the totals are returned once the client closes
+// the stream.
+func (svc *ingestService) StreamReports(stream grpc.ClientStreamingServer[ingestpb.Report, ingestpb.IngestResult]) error {
+	var (
+		project string
+		result  = &ingestpb.IngestResult{}
+	)
+	for {
+		report, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if project == "" {
+			if project, err = svc.authorize(stream.Context(), report.GetProject()); err != nil {
+				return err
+			}
+		}
+
+		tests, err := svc.decodeReport(report, newUploadBudget(svc.s.maxUpload))
+		if err != nil {
+			return err
+		}
+		if err := svc.write(project, []*TestSuites{tests}, result); err != nil {
+			return err
+		}
+	}
+	if project == "" {
+		return status.Error(codes.InvalidArgument, "No reports were uploaded")
+	}
+	return stream.SendAndClose(result)
+}
+
+// StreamTestResults writes the test results in batches of testResultBatch
+// as they are received. The results of a stream are counted as a single
+// report.
+func (svc *ingestService) StreamTestResults(stream grpc.ClientStreamingServer[ingestpb.TestResult, ingestpb.IngestResult]) error {
+	var (
+		project string
+		batch   testResults
+		result  = &ingestpb.IngestResult{}
+	)
+	flush := func() error {
+		if batch.n == 0 {
+			return nil
+		}
+		err := svc.write(project, []*TestSuites{&batch.tests}, result)
+		batch = testResults{}
+		return err
+	}
+
+	for {
+		tr, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if project == "" {
+			if project, err = svc.authorize(stream.Context(), tr.GetProject()); err != nil {
+				return err
+			}
+		}
+
+		if err := batch.add(tr); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if batch.n >= testResultBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if project == "" {
+		return status.Error(codes.InvalidArgument, "No test results were sent")
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	result.Reports = 1
+	return stream.SendAndClose(result)
+}
+
+// testResults collects test results into the testsuites of a report.
+type testResults struct {
+	tests  TestSuites
+	suites map[string]int
+	n      int
+}
+
+// add adds the test result as a testcase of its testsuite.
+func (b *testResults) add(tr *ingestpb.TestResult) error {
+	testcase := TestCase{ClassName: tr.GetClassName(), Name: tr.GetTestName(), Duration: tr.GetDurationSeconds()}
+	switch tr.GetStatus() {
+	case ingestpb.TestResult_STATUS_PASSED:
+	case ingestpb.TestResult_STATUS_FAILED:
+		testcase.Failure = &Failure{Message: tr.GetFailureMessage(), Type: tr.GetFailureType()}
+	case ingestpb.TestResult_STATUS_ERROR:
+		testcase.Error = &Failure{Message: tr.GetFailureMessage(), Type: tr.GetFailureType()}
+	case ingestpb.TestResult_STATUS_SKIPPED:
+		testcase.Skipped = &Skipped{Message: tr.GetFailureMessage()}
+	default:
+		return fmt.Errorf("Must specify the status of %s", tr.GetTestName())
+	}
+
+	if b.suites == nil {
+		b.suites = make(map[string]int)
+	}
+	i, ok := b.suites[tr.GetSuiteName()]
+	if !ok {
+		i = len(b.tests.Items)
+		b.suites[tr.GetSuiteName()] = i
+		b.tests.Items = append(b.tests.Items, TestSuite{Name: tr.GetSuiteName()})
+	}
+	testsuite := &b.tests.Items[i]
+	testsuite.Tests++
+	testsuite.Duration += testcase.Duration
+	switch testcase.Status() {
+	case "failed":
+		testsuite.Failures++
+	case "error":
+		testsuite.Errors++
+	case "skipped":
+		testsuite.Skipped++
+	}
+	testsuite.TestCases = append(testsuite.TestCases, testcase)
+	b.n++
+	return nil
+}
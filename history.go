@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// historyOptions are the options of the history command.
+type historyOptions struct {
+	*reportOptions
+	suite string
+	limit int
+}
+
+func addHistoryFlags(fs *pflag.FlagSet) *historyOptions {
+	o := &historyOptions{reportOptions: addReportFlags(fs)}
+	fs.StringVar(&o.suite, "suite", "", "only read the results of the test in this testsuite")
+	fs.IntVar(&o.limit, "limit", 50, "number of the most recent runs to list; 0 lists all of them")
+	return o
+}
+
+// historySymbols are the characters of each status in the timeline.
+var historySymbols = map[string]string{
+	"passed":  ".",
+	"failed":  "F",
+	"error":   "E",
+	"skipped": "S",
+}
+
+// historyRun is a result of the test.
+type historyRun struct {
+	time, suite, branch, build, commit, status string
+	duration                                   interface{}
+}
+
+// history lists the status and duration of each run of a test within the
+// window of the report from the oldest to the newest. The text output ends
+// with a timeline of the statuses on each branch. The testcase points must
+// have the status as a tag or field, such as with --status-as or --schema
+// v2, for the status to be shown.
+func history(args []string) {
+	fs := pflag.NewFlagSet("history", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "history [options] <test>")
+	o := addHistoryFlags(fs)
+	fs.Parse(args)
+	o.validate(fs)
+	if fs.NArg() != 1 {
+		logger.Exitf(exitUsage, "Must specify the name of the test")
+	}
+	client := o.connect()
+	defer client.Close()
+
+	where := o.where() + ` AND "test_name" = ` + quoteString(fs.Arg(0))
+	if o.suite != "" {
+		where += ` AND "suite_name" = ` + quoteString(o.suite)
+	}
+	stmt := fmt.Sprintf(`SELECT "duration", "status", "suite_name", "branch", "build_number", "commit" FROM %s WHERE %s ORDER BY time DESC`, o.source(), where)
+	if o.limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", o.limit)
+	}
+	var runs []*historyRun
+	err := queryRows(client, o.conn.database, stmt, func(tags map[string]string, values map[string]interface{}) {
+		r := &historyRun{time: fmt.Sprint(values["time"])}
+		r.suite, _ = values["suite_name"].(string)
+		r.branch, _ = values["branch"].(string)
+		r.commit, _ = values["commit"].(string)
+		r.status, _ = values["status"].(string)
+		if v := values["build_number"]; v != nil {
+			r.build = fmt.Sprint(v)
+		}
+		if d, ok := o.seconds(values["duration"]); ok {
+			r.duration = d
+		}
+		runs = append(runs, r)
+	})
+	if err != nil {
+		logger.Exitf(exitConnection, "Could not query the results: %s", err)
+	}
+	if len(runs) == 0 {
+		logger.Warnf("No results for %s within %s", fs.Arg(0), o.since)
+	}
+	// The newest runs were queried first so the limit keeps them.
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+
+	table := &reportTable{columns: []string{"time", "suite", "branch", "build", "commit", "status", "duration"}}
+	for _, r := range runs {
+		commit := r.commit
+		if o.format == "text" && len(commit) > 8 {
+			commit = commit[:8]
+		}
+		table.add(r.time, r.suite, r.branch, r.build, commit, r.status, r.duration)
+	}
+	o.writeOutput(func(w io.Writer) error {
+		if err := table.write(w, o.format); err != nil {
+			return err
+		}
+		if o.format != "text" {
+			return nil
+		}
+		fmt.Fprintln(w)
+		return writeHistoryTimeline(w, runs)
+	})
+}
+
+// writeHistoryTimeline writes a line for each branch with a character for
+// the status of each run from the oldest to the newest.
+func writeHistoryTimeline(w io.Writer, runs []*historyRun) error {
+	var branches []string
+	timelines := make(map[string]*strings.Builder)
+	failures := make(map[string]int)
+	for _, r := range runs {
+		tl, ok := timelines[r.branch]
+		if !ok {
+			tl = new(strings.Builder)
+			timelines[r.branch] = tl
+			branches = append(branches, r.branch)
+		}
+		symbol, ok := historySymbols[r.status]
+		if !ok {
+			symbol = "?"
+		}
+		tl.WriteString(symbol)
+		if failing(r.status) {
+			failures[r.branch]++
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, branch := range branches {
+		name := branch
+		if name == "" {
+			name = "-"
+		}
+		tl := timelines[branch].String()
+		fmt.Fprintf(tw, "%s\t%s\t%d runs, %d failed\n", name, tl, len(tl), failures[branch])
+	}
+	return tw.Flush()
+}
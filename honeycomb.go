@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// honeycombEvent is a single event in a Honeycomb batch request.
+type honeycombEvent struct {
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// honeycombPointsWriter sends each point as a Honeycomb event. The tags and
+// fields of the point are flattened into the columns of the event.
+type honeycombPointsWriter struct {
+	client *http.Client
+	url    string
+	apiKey string
+	events []honeycombEvent
+}
+
+func newHoneycombPointsWriter(apiHost, apiKey, dataset string) *honeycombPointsWriter {
+	return &honeycombPointsWriter{
+		client: http.DefaultClient,
+		url:    strings.TrimSuffix(apiHost, "/") + "/1/batch/" + url.PathEscape(dataset),
+		apiKey: apiKey,
+	}
+}
+
+func (pw *honeycombPointsWriter) Write(pt *influxdb.Point) error {
+	fields, err := pt.Fields()
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]interface{}, len(fields)+len(pt.Tags())+1)
+	data["measurement"] = pt.Name()
+	for k, v := range pt.Tags() {
+		data[k] = v
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+	pw.events = append(pw.events, honeycombEvent{
+		Time: pt.Time(),
+		Data: data,
+	})
+	return nil
+}
+
+// Flush sends the buffered events in a batch. The events are discarded even
+// when the batch fails so they are not sent again with the events of the
+// next flush.
+func (pw *honeycombPointsWriter) Flush() error {
+	if len(pw.events) == 0 {
+		return nil
+	}
+	defer func() { pw.events = pw.events[:0] }()
+
+	body, err := json.Marshal(pw.events)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", pw.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", pw.apiKey)
+
+	resp, err := pw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("honeycomb returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	// The batch endpoint reports the status of each event individually.
+	var results []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &results); err != nil {
+		return fmt.Errorf("unable to decode honeycomb response: %s", err)
+	}
+	// Only the rejected events failed, so the rest are not retried.
+	var rejected int
+	var first error
+	for _, r := range results {
+		if r.Status != http.StatusAccepted {
+			if first == nil {
+				first = fmt.Errorf("status %d: %s", r.Status, r.Error)
+			}
+			rejected++
+		}
+	}
+	if rejected > 0 {
+		return fmt.Errorf("honeycomb rejected %d of %d events, the first with %s", rejected, len(pw.events), first)
+	}
+	return nil
+}
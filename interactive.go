@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmWrite shows what was read from the reports and the points that
+// would be written to the target, then asks whether to write them.
+func confirmWrite(in io.Reader, out io.Writer, c *converter, points []*influxdb.Point, precision, target string) (bool, error) {
+	fmt.Fprintf(out, "Read %d reports with %d suites: %d tests, %d failures, %d errors, %d skipped.\n\n",
+		c.run.files, c.run.suites, c.run.tests, c.run.failures, c.run.errors, c.run.skipped)
+
+	preview := newDryRunPointsWriter(out, precision)
+	for _, pt := range points {
+		preview.Write(pt)
+	}
+	if err := preview.Close(); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(out, "\nWrite %d points to %s? [y/N] ", len(points), target)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
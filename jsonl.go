@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// jsonPoint is the JSON representation of a point.
+type jsonPoint struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        string                 `json:"time"`
+}
+
+// jsonlPointsWriter writes one JSON object per line for each point.
+type jsonlPointsWriter struct {
+	w   *bufio.Writer
+	c   io.Closer
+	enc *json.Encoder
+}
+
+func newJSONLPointsWriter(w io.WriteCloser) *jsonlPointsWriter {
+	bw := bufio.NewWriter(w)
+	return &jsonlPointsWriter{
+		w:   bw,
+		c:   w,
+		enc: json.NewEncoder(bw),
+	}
+}
+
+func (pw *jsonlPointsWriter) Write(pt *influxdb.Point) error {
+	fields, err := pt.Fields()
+	if err != nil {
+		return err
+	}
+	return pw.enc.Encode(jsonPoint{
+		Measurement: pt.Name(),
+		Tags:        pt.Tags(),
+		Fields:      fields,
+		Time:        pt.Time().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (pw *jsonlPointsWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+func (pw *jsonlPointsWriter) Close() error {
+	if err := pw.Flush(); err != nil {
+		pw.c.Close()
+		return err
+	}
+	return pw.c.Close()
+}
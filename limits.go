@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows a number of uploads per interval for each client with
+// a token bucket per client. A client may use the whole number at once.
+type rateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(n int, per time.Duration) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(n) / per.Seconds(),
+		burst:   float64(n),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of the client. When the bucket is
+// empty, it returns false and how long until the next token is added.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		l.prune(now)
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune removes the buckets that have filled up again since they would be
+// the same as a new bucket. It only runs once there are many buckets.
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) < 1024 {
+		return
+	}
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// parseRateLimit parses a rate limit such as 10/m, which allows 10 uploads
+// per minute. The interval is one of s, m, or h.
+func parseRateLimit(s string) (int, time.Duration, error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("expected <count>/<s|m|h>: %s", s)
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid count: %s", s[:i])
+	}
+	per, ok := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[s[i+1:]]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid interval: %s", s[i+1:])
+	}
+	return n, per, nil
+}
+
+// parseByteSize parses a size in bytes with an optional KB, MB, or GB
+// suffix, such as 64MB. The suffixes are powers of 1024.
+func parseByteSize(s string) (int64, error) {
+	v, scale := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, unit := range []struct {
+		suffix string
+		scale  int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(v, unit.suffix) {
+			v, scale = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * scale, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		n       int
+		per     time.Duration
+		wantErr bool
+	}{
+		{s: "10/s", n: 10, per: time.Second},
+		{s: "10/m", n: 10, per: time.Minute},
+		{s: "1/h", n: 1, per: time.Hour},
+		{s: "10", wantErr: true},
+		{s: "0/m", wantErr: true},
+		{s: "-1/m", wantErr: true},
+		{s: "x/m", wantErr: true},
+		{s: "10/d", wantErr: true},
+		{s: "10/", wantErr: true},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			n, per, err := parseRateLimit(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d/%s", n, per)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.n || per != tt.per {
+				t.Errorf("got %d/%s, want %d/%s", n, per, tt.n, tt.per)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "0", want: 0},
+		{s: "512", want: 512},
+		{s: "512B", want: 512},
+		{s: "512KB", want: 512 << 10},
+		{s: "64mb", want: 64 << 20},
+		{s: " 2 GB ", want: 2 << 30},
+		{s: "", wantErr: true},
+		{s: "MB", wantErr: true},
+		{s: "-1MB", wantErr: true},
+		{s: "1.5MB", wantErr: true},
+		{s: "1TB", wantErr: true},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseByteSize(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	// The cases share a limiter of 2 uploads per minute and run in order.
+	l := newRateLimiter(2, time.Minute)
+	start := time.Unix(0, 0)
+	for _, tt := range []struct {
+		name  string
+		key   string
+		after time.Duration
+		ok    bool
+		wait  time.Duration
+	}{
+		{name: "Burst1", key: "a", ok: true},
+		{name: "Burst2", key: "a", ok: true},
+		{name: "Empty", key: "a", ok: false, wait: 30 * time.Second},
+		{name: "OtherClient", key: "b", ok: true},
+		{name: "StillEmpty", key: "a", after: 10 * time.Second, ok: false, wait: 20 * time.Second},
+		{name: "Refilled", key: "a", after: 30 * time.Second, ok: true},
+		{name: "EmptyAgain", key: "a", after: 30 * time.Second, ok: false, wait: 30 * time.Second},
+	} {
+		ok, wait := l.allow(tt.key, start.Add(tt.after))
+		if ok != tt.ok || wait != tt.wait {
+			t.Errorf("%s: got %t %s, want %t %s", tt.name, ok, wait, tt.ok, tt.wait)
+		}
+	}
+}
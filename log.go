@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var logLevelNames = [...]struct{ text, json string }{
+	levelError: {"Error", "error"},
+	levelWarn:  {"Warning", "warn"},
+	levelInfo:  {"Info", "info"},
+	levelDebug: {"Debug", "debug"},
+}
+
+// leveledLogger writes messages to stderr as text, such as
+//
+//	Info: Wrote report (file=a.xml, points=12, elapsed=3ms).
+//
+// or as one json object per line. Messages above the level are discarded.
+type leveledLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level logLevel
+	json  bool
+}
+
+// exit is called by Exitf. It is replaced by commands that need to choose
+// their own exit code.
+var exit = os.Exit
+
+// logger is used for all messages of the tool. Errors and warnings are
+// written by default.
+var logger = &leveledLogger{w: os.Stderr, level: levelWarn}
+
+// logOptions are the logging options shared by the commands.
+type logOptions struct {
+	verbose bool
+	quiet   bool
+	format  string
+}
+
+func addLogFlags(fs *pflag.FlagSet) *logOptions {
+	o := &logOptions{}
+	fs.BoolVarP(&o.verbose, "verbose", "v", false, "also log what was read and written for each report")
+	fs.BoolVarP(&o.quiet, "quiet", "q", false, "only log errors")
+	fs.StringVar(&o.format, "log-format", "text", "format of the log messages (text, json)")
+	return o
+}
+
+// configure applies the options to the logger.
+func (o *logOptions) configure() error {
+	switch o.format {
+	case "text":
+		logger.json = false
+	case "json":
+		logger.json = true
+	default:
+		return fmt.Errorf("Invalid --log-format value: %s", o.format)
+	}
+	switch {
+	case o.verbose && o.quiet:
+		return fmt.Errorf("The --verbose and --quiet options cannot be used together")
+	case o.verbose:
+		logger.level = levelDebug
+	case o.quiet:
+		logger.level = levelError
+	}
+	return nil
+}
+
+// log writes a message with a list of alternating keys and values.
+func (l *leveledLogger) log(level logLevel, msg string, kv ...interface{}) {
+	if level > l.level {
+		return
+	}
+
+	var buf strings.Builder
+	if l.json {
+		entry := map[string]interface{}{
+			"time":  time.Now().UTC().Format(time.RFC3339Nano),
+			"level": logLevelNames[level].json,
+			"msg":   msg,
+		}
+		for i := 0; i+1 < len(kv); i += 2 {
+			// Errors and other values with a String method usually have
+			// no exported fields, so they are written as their text.
+			v := kv[i+1]
+			switch t := v.(type) {
+			case time.Duration:
+				v = t.Seconds()
+			case error:
+				v = t.Error()
+			case fmt.Stringer:
+				v = t.String()
+			}
+			entry[fmt.Sprint(kv[i])] = v
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	} else {
+		buf.WriteString(logLevelNames[level].text)
+		buf.WriteString(": ")
+		buf.WriteString(msg)
+		if len(kv) > 1 {
+			buf.WriteString(" (")
+			for i := 0; i+1 < len(kv); i += 2 {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				fmt.Fprintf(&buf, "%v=%v", kv[i], kv[i+1])
+			}
+			buf.WriteString(")")
+		}
+		buf.WriteString(".\n")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, buf.String())
+}
+
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	l.log(levelError, fmt.Sprintf(format, args...))
+}
+
+func (l *leveledLogger) Warnf(format string, args ...interface{}) {
+	l.log(levelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l *leveledLogger) Info(msg string, kv ...interface{}) {
+	l.log(levelInfo, msg, kv...)
+}
+
+func (l *leveledLogger) Debug(msg string, kv ...interface{}) {
+	l.log(levelDebug, msg, kv...)
+}
+
+// Fatalf logs the error and exits with exitFailure.
+func (l *leveledLogger) Fatalf(format string, args ...interface{}) {
+	l.Exitf(exitFailure, format, args...)
+}
+
+// Exitf logs the error and exits with the exit code.
+func (l *leveledLogger) Exitf(code int, format string, args ...interface{}) {
+	l.Errorf(format, args...)
+	exit(code)
+}
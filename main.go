@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	influxdb "github.com/influxdata/influxdb/client/v2"
@@ -19,10 +28,14 @@ type TestSuites struct {
 type TestSuite struct {
 	Tests      int        `xml:"tests,attr"`
 	Failures   int        `xml:"failures,attr"`
+	Errors     int        `xml:"errors,attr"`
+	Skipped    int        `xml:"skipped,attr"`
 	Duration   float64    `xml:"time,attr"`
 	Name       string     `xml:"name,attr"`
+	Timestamp  string     `xml:"timestamp,attr"`
 	Properties Properties `xml:"properties"`
 	TestCases  []TestCase `xml:"testcase"`
+	Attrs      []xml.Attr `xml:",any,attr"`
 }
 
 type Properties struct {
@@ -35,9 +48,42 @@ type Property struct {
 }
 
 type TestCase struct {
-	ClassName string  `xml:"classname,attr"`
-	Name      string  `xml:"name,attr"`
-	Duration  float64 `xml:"time,attr"`
+	ClassName string     `xml:"classname,attr"`
+	Name      string     `xml:"name,attr"`
+	Duration  float64    `xml:"time,attr"`
+	Failure   *Failure   `xml:"failure"`
+	Error     *Failure   `xml:"error"`
+	Skipped   *Skipped   `xml:"skipped"`
+	Attrs     []xml.Attr `xml:",any,attr"`
+
+	// reruns is the number of duplicates of the testcase that were merged
+	// into it by --dedup merge.
+	reruns int
+}
+
+type Failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type Skipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Status returns the status of the testcase: passed, failed, error, or
+// skipped.
+func (tc *TestCase) Status() string {
+	switch {
+	case tc.Error != nil:
+		return "error"
+	case tc.Failure != nil:
+		return "failed"
+	case tc.Skipped != nil:
+		return "skipped"
+	default:
+		return "passed"
+	}
 }
 
 type PointsWriter interface {
@@ -46,21 +92,128 @@ type PointsWriter interface {
 }
 
 type printPointsWriter struct {
-	w io.Writer
+	w         io.Writer
+	precision string
 }
 
 func (pw *printPointsWriter) Write(pt *influxdb.Point) error {
-	fmt.Fprintln(pw.w, pt.String())
-	return nil
+	_, err := fmt.Fprintln(pw.w, pt.PrecisionString(pw.precision))
+	return err
 }
 
 func (pw *printPointsWriter) Flush() error {
 	return nil
 }
 
+func (pw *printPointsWriter) Close() error {
+	if c, ok := pw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// nopWriteCloser keeps a writer like os.Stdout from being closed by the
+// points writers that close their output.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// formatFromExt returns the output format for a file extension.
+func formatFromExt(path string) string {
+	switch filepath.Ext(path) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".parquet":
+		return "parquet"
+	default:
+		return "line"
+	}
+}
+
+// newOutputPointsWriter creates a points writer for the output format that
+// writes to the path or to stdout if the path is empty.
+func newOutputPointsWriter(path, format, precision string, csvColumns []string) (PointsWriter, error) {
+	if format == "" {
+		format = formatFromExt(path)
+	}
+	switch format {
+	case "line", "csv", "jsonl", "parquet":
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	var w io.WriteCloser = nopWriteCloser{os.Stdout}
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+
+	switch format {
+	case "csv":
+		return newCSVPointsWriter(w, csvColumns), nil
+	case "jsonl":
+		return newJSONLPointsWriter(w), nil
+	case "parquet":
+		return newParquetPointsWriter(w), nil
+	default:
+		return &printPointsWriter{w: w, precision: precision}, nil
+	}
+}
+
+// influxdbPointsWriter writes the points to the /write endpoint of an
+// influxdb server. The request is made directly instead of through the
+// client so the status code and headers of a failed write can be used to
+// decide whether to retry it.
 type influxdbPointsWriter struct {
-	client influxdb.Client
-	bp     influxdb.BatchPoints
+	client   *http.Client
+	url      string
+	username string
+	password string
+	config   influxdb.BatchPointsConfig
+	bp       influxdb.BatchPoints
+	retry    retryPolicy
+	stats    sendStats
+}
+
+func newInfluxdbPointsWriter(conn *connectionOptions, config influxdb.BatchPointsConfig) (*influxdbPointsWriter, error) {
+	u, err := url.Parse(conn.host)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Unsupported protocol scheme: %s", u.Scheme)
+	}
+	u.Path = path.Join(u.Path, "write")
+	params := url.Values{}
+	params.Set("db", config.Database)
+	params.Set("rp", config.RetentionPolicy)
+	params.Set("precision", config.Precision)
+	params.Set("consistency", config.WriteConsistency)
+	u.RawQuery = params.Encode()
+
+	client, err := conn.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	bp, err := influxdb.NewBatchPoints(config)
+	if err != nil {
+		return nil, err
+	}
+	return &influxdbPointsWriter{
+		client:   client,
+		url:      u.String(),
+		username: conn.username,
+		password: conn.password,
+		config:   config,
+		bp:       bp,
+		retry:    retryPolicy{retries: conn.retries, backoff: conn.retryBackoff},
+	}, nil
 }
 
 func (pw *influxdbPointsWriter) Write(pt *influxdb.Point) error {
@@ -68,92 +221,1125 @@ func (pw *influxdbPointsWriter) Write(pt *influxdb.Point) error {
 	return nil
 }
 
+// Flush writes the pending points. The points are discarded even if the
+// write fails so they are not written again by the next flush.
 func (pw *influxdbPointsWriter) Flush() error {
-	return pw.client.Write(pw.bp)
+	bp := pw.bp
+	if len(bp.Points()) == 0 {
+		return nil
+	}
+	next, err := influxdb.NewBatchPoints(pw.config)
+	if err != nil {
+		return err
+	}
+	pw.bp = next
+	return pw.send(encodeLineProtocol(bp.Points(), bp.Precision()))
 }
 
-func main() {
-	host := pflag.StringP("host", "H", "http://localhost:8086", "influxdb server to write to")
-	db := pflag.StringP("database", "d", "", "influxdb database")
-	rp := pflag.StringP("retention-policy", "r", "", "influxdb retention policy")
-	print := pflag.Bool("print", false, "print the line protocol instead of writing to the server")
-	pflag.Parse()
+// send writes the points encoded as line protocol in body.
+func (pw *influxdbPointsWriter) send(body []byte) error {
+	attempts := 0
+	err := pw.retry.do(func() error {
+		attempts++
+		start := time.Now()
+		if err := pw.post(body); err != nil {
+			return err
+		}
+		pw.stats.add(len(body), time.Since(start))
+		return nil
+	})
+	pw.stats.retries += attempts - 1
+	return err
+}
 
-	args := pflag.Args()
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: Must specify at least one argument.\n")
-		os.Exit(1)
+// encodeLineProtocol encodes the points as line protocol with timestamps in
+// the precision.
+func encodeLineProtocol(points []*influxdb.Point, precision string) []byte {
+	var buf bytes.Buffer
+	for _, pt := range points {
+		buf.WriteString(pt.PrecisionString(precision))
+		buf.WriteByte('\n')
 	}
+	return buf.Bytes()
+}
 
-	var pw PointsWriter
-	if *print {
-		pw = &printPointsWriter{w: os.Stdout}
-	} else {
-		client, err := influxdb.NewHTTPClient(influxdb.HTTPConfig{
-			Addr: *host,
-		})
+func (pw *influxdbPointsWriter) sendStats() (sendStats, bool) {
+	return pw.stats, true
+}
+
+func (pw *influxdbPointsWriter) post(body []byte) error {
+	req, err := http.NewRequest("POST", pw.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "influx-junit")
+	if pw.username != "" {
+		req.SetBasicAuth(pw.username, pw.password)
+	}
+
+	resp, err := pw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return &httpError{
+			status:     resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			msg:        strings.TrimSpace(string(respBody)),
+		}
+	}
+	return nil
+}
+
+// bufferedPointsWriter holds the points of a report until it has been
+// converted so a report that fails part of the way through is not written.
+type bufferedPointsWriter struct {
+	points []*influxdb.Point
+}
+
+func (pw *bufferedPointsWriter) Write(pt *influxdb.Point) error {
+	pw.points = append(pw.points, pt)
+	return nil
+}
+
+func (pw *bufferedPointsWriter) Flush() error {
+	return nil
+}
+
+// writeTo writes the buffered points and resets the buffer.
+func (pw *bufferedPointsWriter) writeTo(w PointsWriter) error {
+	defer func() { pw.points = pw.points[:0] }()
+	for _, pt := range pw.points {
+		if err := w.Write(pt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseKeyValues parses a list of key=value pairs.
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("expected key=value: %s", pair)
+		}
+		m[pair[:i]] = pair[i+1:]
+	}
+	return m, nil
+}
+
+// decodeTestSuites decodes a junit report.
+func decodeTestSuites(r io.Reader) (*TestSuites, error) {
+	var tests TestSuites
+	dec := xml.NewDecoder(r)
+	if err := dec.Decode(&tests); err != nil {
+		return nil, err
+	}
+	return &tests, nil
+}
+
+// readTestSuitesFile opens and decodes the report at path.
+func readTestSuitesFile(path string) (*TestSuites, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file: %s", err)
+	}
+	defer f.Close()
+
+	tests, err := decodeTestSuites(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode file %s: %s", path, err)
+	}
+	return tests, nil
+}
+
+// ingestOptions are the command line options of the ingest command.
+type ingestOptions struct {
+	measurement            *string
+	aggregateOnly          *bool
+	minDuration            *time.Duration
+	sample                 *string
+	includeSuites          *[]string
+	excludeSuites          *[]string
+	includeTests           *[]string
+	excludeTests           *[]string
+	measurementPerSuite    *bool
+	suiteSummaries         *bool
+	suiteMeasurement       *string
+	suitePercentiles       *bool
+	suiteHistogram         *[]string
+	classSummaries         *bool
+	classMeasurement       *string
+	runSummary             *bool
+	runMeasurement         *string
+	tags                   *[]string
+	fields                 *[]string
+	testManifestFile       *string
+	testChangesMeasurement *string
+	testID                 *bool
+	hashTestNames          *bool
+	hashTestNamesOver      *int
+	durationUnit           *string
+	durationType           *string
+	schema                 *string
+	schemaMappingFile      *string
+	classNameTag           *bool
+	packageTag             *bool
+	packageDepth           *int
+	failureFields          *bool
+	timestamp              *string
+	timeSource             *string
+	timeScope              *string
+	statusAs               *string
+	noCITags               *bool
+	ciTagSpecs             *[]string
+	gitTags                *bool
+	githubMatrix           *string
+	githubJobSummary       *bool
+	annotationMeasurement  *string
+	grafanaURL             *string
+	grafanaToken           *string
+	notifyWebhook          *string
+	notifyFormat           *string
+	notifyThreshold        *int
+	failIf                 *[]string
+	dedup                  *string
+	failureClusters        *bool
+	clusterMeasurement     *string
+	summaryMarkdown        *string
+	githubCheck            *bool
+	githubCheckName        *string
+	githubCheckURL         *string
+	githubToken            *string
+	statsJSON              *string
+	summaryCompareBranch   *string
+	regressionBaseline     *string
+	regressionWindow       *string
+	regressionFactor       *float64
+	regressionMeasurement  *string
+	ingestHost             *bool
+	reportFileTag          *string
+	pathTags               *[]string
+	tagInclude             *[]string
+	tagExclude             *[]string
+	scrub                  *[]string
+	scrubReplacement       *string
+	sanitizeTags           *bool
+	maxTagLength           *int
+	warnSeries             *int
+	maxSeries              *int
+	configFile             *string
+	conn                   *connectionOptions
+	log                    *logOptions
+	dryRun                 *bool
+	check                  *bool
+	progress               *bool
+	interactive            *bool
+	stream                 *bool
+	print                  *bool
+	output                 *string
+	outputFormat           *string
+	csvColumns             *[]string
+	honeycombDataset       *string
+	honeycombAPIKey        *string
+	honeycombAPIHost       *string
+	writerPlugin           *string
+	writerPluginArgs       *[]string
+	writerPluginFormat     *string
+	failFast               *bool
+	telegrafExecd          *bool
+}
+
+// newIngestOptions defines the options of the ingest command.
+func newIngestOptions(fs *pflag.FlagSet) *ingestOptions {
+	o := &ingestOptions{}
+	o.measurement = fs.StringP("measurement", "m", "junit_test_results", "measurement to write to; {name} is replaced by the tag or environment variable with that name")
+	o.aggregateOnly = fs.Bool("aggregate-only", false, "only write the testsuite and run summaries instead of a point for each testcase")
+	o.minDuration = fs.Duration("min-duration", 0, "only write points for testcases that took at least this long")
+	o.sample = fs.String("sample", "", "only write the points for a deterministic sample of the testcases, such as 10% or 1/20; the summaries still include every testcase")
+	o.includeSuites = fs.StringArray("include-suite", nil, "only write testsuites with names matching this regex (may be repeated)")
+	o.excludeSuites = fs.StringArray("exclude-suite", nil, "do not write testsuites with names matching this regex (may be repeated)")
+	o.includeTests = fs.StringArray("include-test", nil, "only write testcases with names matching this regex (may be repeated)")
+	o.excludeTests = fs.StringArray("exclude-test", nil, "do not write testcases with names matching this regex (may be repeated)")
+	o.measurementPerSuite = fs.Bool("measurement-per-suite", false, "write the testcases of each testsuite to their own measurement named after the measurement and the suite name")
+	o.suiteSummaries = fs.Bool("suite-summaries", false, "also write a summary point for each testsuite")
+	o.suiteMeasurement = fs.String("suite-measurement", "junit_suite_results", "measurement to write the testsuite summaries to")
+	o.suitePercentiles = fs.Bool("suite-percentiles", false, "add testcase duration percentiles to the testsuite summaries")
+	o.suiteHistogram = fs.StringSlice("suite-histogram", nil, "add counts of testcases within these duration bounds in seconds to the testsuite summaries")
+	o.classSummaries = fs.Bool("class-summaries", false, "also write a summary point for each classname in a testsuite")
+	o.classMeasurement = fs.String("class-measurement", "junit_class_results", "measurement to write the classname summaries to")
+	o.runSummary = fs.Bool("run-summary", false, "also write a summary point for the whole run")
+	o.runMeasurement = fs.String("run-measurement", "junit_run", "measurement to write the run summary to")
+	o.failureClusters = fs.Bool("failure-clusters", false, "also write a point for each group of failures with the same type and message once line numbers, addresses, and timestamps are removed")
+	o.clusterMeasurement = fs.String("failure-cluster-measurement", "junit_failure_clusters", "measurement to write the failure clusters to")
+	o.annotationMeasurement = fs.String("annotation-measurement", "", "also write a point with a title and text for the run to this measurement for grafana annotations")
+	o.grafanaURL = fs.String("grafana-url", "", "create an annotation for the run with the api of this grafana server")
+	o.grafanaToken = fs.String("grafana-token", "", "grafana api token or service account token")
+	o.summaryMarkdown = fs.String("summary-md", "", "write the totals, failed tests, and slowest tests as markdown to this file, or - for stdout")
+	o.summaryCompareBranch = fs.String("summary-compare-branch", "", "compare the markdown summary with the results of this branch from the last 30 days in influxdb")
+	o.regressionBaseline = fs.String("regression-baseline", "", "compare the duration of each testcase with its median on this branch in influxdb and write a point for each one that slowed down")
+	o.regressionWindow = fs.String("regression-window", "14d", "how far back to read the durations of the baseline branch")
+	o.regressionFactor = fs.Float64("regression-factor", 1.5, "how many times its baseline duration a testcase must take to be a regression")
+	o.regressionMeasurement = fs.String("regression-measurement", "junit_test_regressions", "measurement to write the duration regressions to")
+	o.githubCheck = fs.Bool("github-check", false, "create or update a github check run on the commit with the summary of the run")
+	o.githubCheckName = fs.String("github-check-name", "Test results", "name of the github check run")
+	o.githubCheckURL = fs.String("github-check-url", "", "dashboard url to link from the github check run; defaults to the influxdb query url")
+	o.githubToken = fs.String("github-token", "", "github token used to create the check run and to download the artifacts of workflow runs in serve and fetch; defaults to the GITHUB_TOKEN environment variable")
+	o.statsJSON = fs.String("stats-json", "", "write statistics about the run as json to this file, or - for stdout")
+	o.notifyWebhook = fs.String("notify-webhook", "", "post a summary of the failed tests to this webhook url")
+	o.notifyFormat = fs.String("notify-format", "slack", "format of the webhook payload (slack, json)")
+	o.notifyThreshold = fs.Int("notify-threshold", 1, "only notify when at least this many tests failed")
+	o.tags = fs.StringArrayP("tag", "t", nil, "tag to add to every point as key=value (may be repeated); the value may be a go template")
+	o.fields = fs.StringArrayP("field", "f", nil, "field to add to every point as key=value (may be repeated); use a trailing i for integers or double quotes for strings; the value may be a go template")
+	o.testManifestFile = fs.String("test-manifest", "", "compare the testcases with the ones stored in this file by the previous run, write a point for each new or removed test, and store the testcases of this run")
+	o.testChangesMeasurement = fs.String("test-changes-measurement", "junit_test_changes", "measurement to write the new and removed tests to")
+	o.testID = fs.Bool("test-id", false, "add a test_id field with a stable hash of the suite, classname, and test name")
+	o.hashTestNames = fs.Bool("hash-test-names", false, "replace the test_name tag with a hash and write the full name to the test_name_full field")
+	o.hashTestNamesOver = fs.Int("hash-test-names-over", 0, "only hash test names longer than this many bytes (implies --hash-test-names)")
+	o.durationUnit = fs.String("duration-unit", "s", "unit of the duration fields (s, ms, us)")
+	o.durationType = fs.String("duration-type", "float", "type of the duration fields (float, int)")
+	o.schema = fs.String("schema", "v1", "schema defaults to use; v2 enables the status tag, classname tag, failure fields, and suite summaries")
+	o.schemaMappingFile = fs.String("schema-mapping", "", "yaml file describing the measurements, tags, and fields of the testcase and testsuite points")
+	o.classNameTag = fs.Bool("classname-tag", false, "add a classname tag to the testcase points")
+	o.packageTag = fs.Bool("package-tag", false, "add a package tag with the dotted prefix of the classname to the testcase points")
+	o.packageDepth = fs.Int("package-depth", 0, "only use this many components of the classname prefix for the package tag (implies --package-tag)")
+	o.failureFields = fs.Bool("failure-fields", false, "add failure_message and failure_type fields to the points of failed testcases")
+	o.timestamp = fs.String("timestamp", "", "time to write the points with as RFC3339 or unix seconds instead of the current time")
+	o.timeSource = fs.String("time-source", "now", "source of the point timestamps (now, suite, timeline, mtime)")
+	o.timeScope = fs.String("time-scope", "run", "how often the current time is read for the point timestamps (run, file, suite)")
+	o.statusAs = fs.String("status-as", "", "write the testcase status as a tag, field, or both")
+	o.noCITags = fs.Bool("no-ci-tags", false, "do not add tags with the build metadata of the detected CI provider")
+	o.ciTagSpecs = fs.StringSlice("ci-tags", nil, "only add these CI tags; use name=newname to rename a tag")
+	o.gitTags = fs.Bool("git-tags", false, "add the commit and branch tags and the dirty field from the git repository of the working directory when no CI provider is detected")
+	o.githubMatrix = fs.String("github-matrix", "", "github actions matrix context as json, such as ${{ toJSON(matrix) }}, to add as matrix_<key> tags")
+	o.githubJobSummary = fs.Bool("github-job-summary", false, "append the run totals and the influxdb query url to the github actions job summary")
+	o.ingestHost = fs.Bool("ingest-host", false, "add an ingest_host tag with the hostname of the machine running the tool")
+	o.reportFileTag = fs.String("report-file-tag", "", "add a report_file tag with the base name (base) or relative path (path) of the report")
+	fs.Lookup("report-file-tag").NoOptDefVal = "base"
+	o.pathTags = fs.StringArray("path-tag", nil, "derive a tag from the report path as key=regex (may be repeated)")
+	o.tagInclude = fs.StringSlice("tag-include", nil, "only write these tags")
+	o.tagExclude = fs.StringSlice("tag-exclude", nil, "do not write these tags")
+	o.scrub = fs.StringArray("scrub", nil, "redact matches of this regex or preset (email, ipv4, uuid) from names, messages, and properties (may be repeated)")
+	o.scrubReplacement = fs.String("scrub-replacement", "[REDACTED]", "text to replace scrubbed matches with")
+	o.sanitizeTags = fs.Bool("sanitize-tags", false, "trim whitespace and replace newlines in tag values")
+	o.maxTagLength = fs.Int("max-tag-length", 0, "truncate tag values longer than this many bytes")
+	o.warnSeries = fs.Int("warn-series", 0, "warn when a run writes more than this many series")
+	o.maxSeries = fs.Int("max-series", 0, "abort when a run would write more than this many series")
+	o.configFile = fs.String("config", "", "yaml config file with option values; flags override the file (default influx-junit.yaml if it exists)")
+	o.conn = addConnectionFlags(fs)
+	o.log = addLogFlags(fs)
+	o.dryRun = fs.Bool("dry-run", false, "read the reports and check the connection to the server and the database, then print a summary of the points that would be written instead of writing them")
+	o.print = fs.Bool("print", false, "print the line protocol instead of writing to the server")
+	o.output = fs.StringP("output", "o", "", "write the points to a file instead of the server")
+	o.outputFormat = fs.String("output-format", "", "format of the output (line, jsonl, csv, parquet); inferred from the output file extension by default")
+	o.csvColumns = fs.StringSlice("csv-columns", nil, "columns to write in csv output (default time,suite_name,test_name,duration)")
+	o.honeycombDataset = fs.String("honeycomb-dataset", "", "send events to this honeycomb dataset instead of influxdb")
+	o.honeycombAPIKey = fs.String("honeycomb-api-key", "", "honeycomb api key; defaults to the HONEYCOMB_API_KEY environment variable")
+	o.honeycombAPIHost = fs.String("honeycomb-api-host", "https://api.honeycomb.io", "honeycomb api host")
+	o.writerPlugin = fs.String("writer-plugin", "", "stream the points to this writer plugin executable instead of the server")
+	o.writerPluginArgs = fs.StringArray("writer-plugin-arg", nil, "argument to pass to the writer plugin (may be repeated)")
+	o.writerPluginFormat = fs.String("writer-plugin-format", "line", "format of the points sent to the writer plugin (line, jsonl)")
+	o.check = fs.Bool("check", false, "ping the server and check that the database exists before reading the reports")
+	o.progress = fs.Bool("progress", false, "print the progress after each report and a summary of the run to stderr")
+	o.interactive = fs.Bool("interactive", false, "show a summary of the reports and the points to write and ask before writing them")
+	o.stream = fs.Bool("stream", false, "read the output of go test -json from stdin and write the point for each test as soon as it finishes")
+	o.failIf = fs.StringArray("fail-if", nil, "exit with code 6 when the run matches this condition, such as failures>0 or pass_rate<0.98, after writing the points (may be repeated)")
+	o.dedup = fs.String("dedup", "", "write a testcase that appears in several reports once, keeping the first, last, or worst result, or merge to keep the last with a reruns field")
+	o.failFast = fs.Bool("fail-fast", false, "stop at the first report that cannot be read or written instead of continuing with the remaining reports")
+	o.telegrafExecd = fs.Bool("telegraf-execd", false, "run as a telegraf execd input reading report paths or xml from stdin")
+	return o
+}
+
+// ingest writes the points for the reports given as arguments.
+func ingest(args []string) {
+	fs := pflag.NewFlagSet("ingest", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "ingest [options] <file>...")
+	o := newIngestOptions(fs)
+	fs.Parse(args)
+	runIngest(fs, o, fs.Args(), nil)
+}
+
+// newIngestConverter reads the environment and config file into the
+// options, validates them, and returns the converter and the write
+// precision. The runFields are added to the run summary, which is enabled
+// when there are any.
+func newIngestConverter(fs *pflag.FlagSet, o *ingestOptions, runFields map[string]interface{}) (*converter, string) {
+	// Options are read from the command line, then the environment, and
+	// then the config file. Each only sets the options that are not set yet.
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+
+	// The schema mapping may be included in the config file instead of
+	// being read from a separate file.
+	var configMapping *schemaMapping
+	if path := findConfigFile(*o.configFile); path != "" {
+		cfg, err := readConfigFile(path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Could not create HTTP client: %s.\n", err)
-			os.Exit(1)
+			logger.Exitf(exitUsage, "Unable to read config file %s: %s", path, err)
+		}
+		if v, ok := cfg["schema-mapping"].(map[string]interface{}); ok {
+			if configMapping, err = parseSchemaMapping(v); err != nil {
+				logger.Exitf(exitUsage, "Invalid schema mapping in %s: %s", path, err)
+			}
+			delete(cfg, "schema-mapping")
 		}
+		if err := applyConfig(fs, cfg); err != nil {
+			logger.Exitf(exitUsage, "Invalid config file %s: %s", path, err)
+		}
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+	if path := findConfigFile(*o.configFile); path != "" {
+		logger.Debug("Read config file", "file", path)
+	}
 
-		bp, err := influxdb.NewBatchPoints(influxdb.BatchPointsConfig{
-			Database:        *db,
-			RetentionPolicy: *rp,
-		})
+	switch *o.schema {
+	case "v1":
+	case "v2":
+		// Only change the defaults so the individual options can still
+		// be used to adjust the schema.
+		defaults := map[string]string{
+			"status-as":       "tag",
+			"classname-tag":   "true",
+			"failure-fields":  "true",
+			"suite-summaries": "true",
+		}
+		for name, value := range defaults {
+			if !fs.Changed(name) {
+				fs.Set(name, value)
+			}
+		}
+	default:
+		logger.Exitf(exitUsage, "Invalid --schema value: %s", *o.schema)
+	}
+
+	if *o.measurementPerSuite {
+		*o.measurement += "_{suite_name}"
+	}
+
+	precision, ok := o.conn.writePrecision()
+	if !ok {
+		logger.Exitf(exitUsage, "Invalid --precision value: %s", o.conn.precision)
+	}
+	if _, err := o.conn.proxyFunc(); err != nil {
+		logger.Exitf(exitUsage, "Invalid --proxy value: %s", err)
+	}
+	if o.conn.createDatabase && o.conn.database == "" {
+		logger.Exitf(exitUsage, "Must specify a database to create with --database")
+	}
+	if o.conn.createBucket {
+		if o.conn.createDatabase {
+			logger.Exitf(exitUsage, "The --create-database and --create-bucket options cannot be used together")
+		} else if o.conn.database == "" {
+			logger.Exitf(exitUsage, "Must specify the database of the bucket to create with --database")
+		} else if o.conn.org == "" {
+			logger.Exitf(exitUsage, "Must specify the organization of the bucket to create with --org")
+		}
+	}
+
+	durationScales := map[string]float64{"s": 1, "ms": 1e3, "us": 1e6}
+	durationScale, ok := durationScales[*o.durationUnit]
+	if !ok {
+		logger.Exitf(exitUsage, "Invalid --duration-unit value: %s", *o.durationUnit)
+	}
+	if *o.durationType != "float" && *o.durationType != "int" {
+		logger.Exitf(exitUsage, "Invalid --duration-type value: %s", *o.durationType)
+	}
+
+	switch *o.timeSource {
+	case "now", "suite", "timeline", "mtime":
+	default:
+		logger.Exitf(exitUsage, "Invalid --time-source value: %s", *o.timeSource)
+	}
+
+	switch *o.timeScope {
+	case "run", "file", "suite":
+	default:
+		logger.Exitf(exitUsage, "Invalid --time-scope value: %s", *o.timeScope)
+	}
+	if *o.timestamp != "" && *o.timeScope != "run" {
+		logger.Exitf(exitUsage, "The --timestamp and --time-scope options cannot be used together")
+	}
+
+	switch *o.reportFileTag {
+	case "", "base", "path":
+	default:
+		logger.Exitf(exitUsage, "Invalid --report-file-tag value: %s", *o.reportFileTag)
+	}
+
+	switch *o.notifyFormat {
+	case "slack", "json":
+	default:
+		logger.Exitf(exitUsage, "Invalid --notify-format value: %s", *o.notifyFormat)
+	}
+
+	switch *o.statusAs {
+	case "", "tag", "field", "both":
+	default:
+		logger.Exitf(exitUsage, "Invalid --status-as value: %s", *o.statusAs)
+	}
+
+	switch *o.dedup {
+	case "", "first", "last", "worst", "merge":
+	default:
+		logger.Exitf(exitUsage, "Invalid --dedup value: %s", *o.dedup)
+	}
+
+	var sampleRate float64
+	if *o.sample != "" {
+		r, err := parseSampleRate(*o.sample)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --sample value: %s", err)
+		}
+		sampleRate = r
+	}
+
+	staticTags, err := parseKeyValues(*o.tags)
+	if err != nil {
+		logger.Exitf(exitUsage, "Invalid tag: %s", err)
+	}
+
+	staticFields, err := parseKeyValues(*o.fields)
+	if err != nil {
+		logger.Exitf(exitUsage, "Invalid field: %s", err)
+	}
+
+	c := &converter{
+		measurement:       *o.measurement,
+		minDuration:       o.minDuration.Seconds(),
+		sampleRate:        sampleRate,
+		suitePercentiles:  *o.suitePercentiles,
+		testID:            *o.testID,
+		statusAs:          *o.statusAs,
+		classNameTag:      *o.classNameTag,
+		packageTag:        *o.packageTag || *o.packageDepth > 0,
+		packageDepth:      *o.packageDepth,
+		failureFields:     *o.failureFields,
+		timeSource:        *o.timeSource,
+		timeScope:         *o.timeScope,
+		reportFileTag:     *o.reportFileTag,
+		durationScale:     durationScale,
+		durationInt:       *o.durationType == "int",
+		hashTestNames:     *o.hashTestNames || *o.hashTestNamesOver > 0,
+		hashTestNamesOver: *o.hashTestNamesOver,
+		tags:              make(map[string]string),
+		fields:            make(map[string]interface{}),
+		tagTemplates:      make(map[string]*template.Template),
+		fieldTemplates:    make(map[string]*template.Template),
+		tagFilter:         newKeyFilter(*o.tagInclude, *o.tagExclude),
+		scrubber: scrubber{
+			replacement: *o.scrubReplacement,
+		},
+		sanitizer: tagSanitizer{
+			clean:     *o.sanitizeTags,
+			maxLength: *o.maxTagLength,
+		},
+		series: seriesGuard{
+			warn: *o.warnSeries,
+			max:  *o.maxSeries,
+		},
+	}
+	var (
+		ciTags   map[string]string
+		ciFields map[string]interface{}
+	)
+	if !*o.noCITags {
+		ciTags, ciFields = detectCI()
+	}
+	if ciTags == nil && *o.gitTags {
+		if ciTags, ciFields, err = detectGit(); err != nil {
+			logger.Warnf("Could not read the git metadata: %s", err)
+		}
+	}
+	if provider, ok := ciTags["ci_provider"]; ok {
+		logger.Debug("Detected CI provider", "provider", provider)
+	}
+	if ciTags, err = selectCITags(ciTags, *o.ciTagSpecs); err != nil {
+		logger.Exitf(exitUsage, "Invalid --ci-tags value: %s", err)
+	}
+	// Added first so they can be overridden with --tag.
+	for k, v := range ciTags {
+		c.tags[k] = v
+	}
+	for k, v := range ciFields {
+		c.fields[k] = v
+	}
+	if *o.githubMatrix != "" {
+		matrixTags, err := parseMatrixTags(*o.githubMatrix)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --github-matrix value: %s", err)
+		}
+		for k, v := range matrixTags {
+			c.tags[k] = v
+		}
+	}
+	for k, v := range staticTags {
+		tmpl, err := parseValueTemplate(k, v)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid tag template: %s", err)
+		} else if tmpl != nil {
+			c.tagTemplates[k] = tmpl
+			continue
+		}
+		c.tags[k] = v
+	}
+	for k, v := range staticFields {
+		tmpl, err := parseValueTemplate(k, v)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid field template: %s", err)
+		} else if tmpl != nil {
+			c.fieldTemplates[k] = tmpl
+			continue
+		}
+		c.fields[k] = parseFieldValue(v)
+	}
+	for _, bound := range *o.suiteHistogram {
+		v, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid histogram bound: %s", bound)
+		}
+		c.suiteHistogram = append(c.suiteHistogram, v)
+	}
+	for _, pattern := range *o.scrub {
+		if err := c.scrubber.add(pattern); err != nil {
+			logger.Exitf(exitUsage, "Invalid scrub pattern: %s", err)
+		}
+	}
+	if *o.ingestHost {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Fatalf("Could not determine the hostname: %s", err)
+		}
+		c.tags["ingest_host"] = hostname
+	}
+	for _, spec := range *o.pathTags {
+		rule, err := parsePathTagRule(spec)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid path tag: %s", err)
+		}
+		c.pathTagRules = append(c.pathTagRules, rule)
+	}
+	for _, expr := range *o.failIf {
+		g, err := parseGateCondition(expr)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --fail-if value: %s", err)
+		}
+		c.gates = append(c.gates, g)
+	}
+	if c.suiteFilter, err = newNameFilter(*o.includeSuites, *o.excludeSuites); err != nil {
+		logger.Exitf(exitUsage, "Invalid suite filter: %s", err)
+	}
+	if c.testFilter, err = newNameFilter(*o.includeTests, *o.excludeTests); err != nil {
+		logger.Exitf(exitUsage, "Invalid test filter: %s", err)
+	}
+	if *o.schemaMappingFile != "" {
+		mapping, err := readSchemaMapping(*o.schemaMappingFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Could not create batch points: %s.\n", err)
-			os.Exit(1)
+			logger.Exitf(exitUsage, "Invalid schema mapping %s: %s", *o.schemaMappingFile, err)
 		}
-		pw = &influxdbPointsWriter{
-			client: client,
-			bp:     bp,
+		configMapping = mapping
+	}
+	if configMapping != nil {
+		c.mapping = *configMapping
+		if configMapping.suite != nil {
+			*o.suiteSummaries = true
+		}
+	}
+	if *o.testManifestFile != "" {
+		if c.manifest, err = readTestManifest(*o.testManifestFile); err != nil {
+			logger.Exitf(exitUsage, "Unable to read test manifest %s: %s", *o.testManifestFile, err)
+		}
+	}
+	if *o.regressionBaseline != "" {
+		if !influxDurationRE.MatchString(*o.regressionWindow) {
+			logger.Exitf(exitUsage, "Invalid --regression-window value: %s", *o.regressionWindow)
+		} else if *o.regressionFactor <= 1 {
+			logger.Exitf(exitUsage, "Invalid --regression-factor value: must be greater than 1")
+		} else if strings.Contains(*o.measurement, "{") {
+			logger.Exitf(exitUsage, "Cannot use --regression-baseline when the measurement is a template")
+		}
+	}
+	if *o.summaryMarkdown != "" || *o.githubCheck || *o.regressionBaseline != "" {
+		c.recordDurations = true
+	}
+	c.clusterFailures = *o.failureClusters
+	if len(runFields) > 0 {
+		c.runFields = runFields
+		*o.runSummary = true
+	}
+	if *o.aggregateOnly {
+		c.aggregateOnly = true
+		*o.suiteSummaries = true
+		*o.runSummary = true
+	}
+	if *o.suiteSummaries {
+		c.suiteMeasurement = *o.suiteMeasurement
+	}
+	if *o.classSummaries {
+		c.classMeasurement = *o.classMeasurement
+	}
+
+	return c, precision
+}
+
+// runIngest writes the points for the reports with the parsed options.
+func runIngest(fs *pflag.FlagSet, o *ingestOptions, files []string, runFields map[string]interface{}) {
+	c, precision := newIngestConverter(fs, o, runFields)
+
+	if *o.telegrafExecd {
+		if err := runTelegrafExecd(c, os.Stdin, os.Stdout, precision); err != nil {
+			logger.Fatalf("Could not read from stdin: %s", err)
+		}
+		return
+	}
+
+	if *o.stream {
+		if len(files) > 0 {
+			logger.Exitf(exitUsage, "Cannot read report files with --stream")
+		} else if *o.dedup != "" {
+			logger.Exitf(exitUsage, "The --stream and --dedup options cannot be used together")
+		} else if *o.interactive {
+			logger.Exitf(exitUsage, "The --stream and --interactive options cannot be used together")
+		}
+	} else if len(files) == 0 {
+		logger.Exitf(exitUsage, "Must specify at least one argument")
+	}
+
+	if *o.interactive {
+		if *o.dryRun {
+			logger.Exitf(exitUsage, "The --interactive and --dry-run options cannot be used together")
+		} else if !isTerminal(os.Stdin) {
+			logger.Exitf(exitUsage, "The --interactive option requires a terminal")
 		}
 	}
 
 	now := time.Now()
-	for _, arg := range args {
-		f, err := os.Open(arg)
+	if *o.timestamp != "" {
+		t, err := parseTimestamp(*o.timestamp)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Unable to open file: %s.\n", err)
-			os.Exit(1)
+			logger.Exitf(exitUsage, "Invalid --timestamp value: %s", err)
 		}
+		now = t
+	}
 
-		var tests TestSuites
-		dec := xml.NewDecoder(f)
-		if err := dec.Decode(&tests); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Unable to decode file %s: %s.\n", arg, err)
-			f.Close()
-			os.Exit(1)
+	var (
+		pw               PointsWriter
+		target, queryURL string
+		counter          *countingPointsWriter
+	)
+	openWriter := func() {
+		pw, target, queryURL = newIngestWriter(o, c, precision)
+		if *o.statsJSON != "" {
+			counter = newCountingPointsWriter(pw)
+			pw = counter
 		}
-		f.Close()
+	}
+
+	// In interactive mode every point is held until the user confirms
+	// that they should be written. The writer is only opened then so
+	// declining does not create the database or truncate the output.
+	var staged *bufferedPointsWriter
+	if *o.interactive {
+		staged, target = &bufferedPointsWriter{}, ingestTarget(o)
+		pw = staged
+	} else {
+		openWriter()
+	}
+
+	// Each report is converted into a buffer first so the points of a
+	// report that cannot be converted are not written. The remaining
+	// reports are still written unless --fail-fast is used.
+	var (
+		buf                           bufferedPointsWriter
+		written, parseErrs, writeErrs int
+		progress                      *progressReporter
+		messages                      []string
+		started                       = time.Now()
+	)
+	if *o.progress {
+		progress = newProgressReporter(os.Stderr, c, pw, len(files))
+	}
 
-		for _, testsuite := range tests.Items {
-			for _, testcase := range testsuite.TestCases {
-				pt, err := influxdb.NewPoint("junit_test_results",
-					map[string]string{
-						"suite_name": testsuite.Name,
-						"test_name":  testcase.Name,
-					},
-					map[string]interface{}{
-						"duration": testcase.Duration,
-					},
-					now,
-				)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error: Could not create point: %s.\n", err)
-					os.Exit(1)
-				}
-				if err := pw.Write(pt); err != nil {
-					fmt.Fprintf(os.Stderr, "Error: Could not write point: %s.\n", err)
-					os.Exit(1)
-				}
+	// Deduplicating needs every report before any of them are written.
+	var (
+		reports    map[string]*TestSuites
+		readErrors map[string]error
+	)
+	if *o.dedup != "" {
+		reports, readErrors = readDedupReports(files, *o.dedup)
+	}
+	for _, arg := range files {
+		var err error
+		if reports == nil {
+			err = ingestFile(c, pw, &buf, arg, now)
+		} else if err = readErrors[arg]; err == nil {
+			err = ingestReport(c, pw, &buf, reports[arg], arg, now)
+		}
+		if err != nil {
+			code := exitCode(err)
+			if code == exitConnection && written > 0 {
+				code = exitPartialWrite
+			}
+			// The later reports would only add more series.
+			if *o.failFast || code == exitSeriesLimit {
+				logger.Exitf(code, "%s", err)
+			}
+			logger.Errorf("%s", err)
+			messages = append(messages, err.Error())
+			if c.manifest != nil {
+				c.manifest.incomplete = true
 			}
+			if code == exitParse {
+				parseErrs++
+			} else {
+				writeErrs++
+			}
+		} else {
+			written++
+		}
+		if progress != nil {
+			progress.report(arg, err)
 		}
+	}
+	if *o.stream {
+		if err := c.writeGoTestEvents(pw, os.Stdin); err != nil {
+			logger.Exitf(exitCode(err), "%s", err)
+		}
+		written++
+	}
+
+	// A failure to write the points after the reports means the points
+	// of the reports were written, so it is only a partial write.
+	flushCode := exitPartialWrite
+	if written == 0 {
+		flushCode = exitConnection
+	}
+	if *o.runSummary {
+		if err := c.writeRunSummary(pw, *o.runMeasurement, now); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(flushCode, "Could not write points: %s", err)
+		}
+	}
+
+	if *o.annotationMeasurement != "" {
+		if err := c.writeRunAnnotation(pw, *o.annotationMeasurement, now); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(flushCode, "Could not write points: %s", err)
+		}
+	}
+
+	if c.clusterFailures {
+		if err := c.writeFailureClusters(pw, *o.clusterMeasurement, now); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(flushCode, "Could not write points: %s", err)
+		}
+	}
+
+	if *o.regressionBaseline != "" {
+		if err := writeRegressions(c, pw, o, now); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(flushCode, "Could not write points: %s", err)
+		}
+	}
+
+	if c.manifest != nil {
+		if err := c.writeTestChanges(pw, *o.testChangesMeasurement, now); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(flushCode, "Could not write points: %s", err)
+		}
+	}
 
+	if staged != nil {
+		ok, err := confirmWrite(os.Stdin, os.Stderr, c, staged.points, precision, target)
+		if err != nil {
+			logger.Fatalf("Could not read the answer: %s", err)
+		} else if !ok {
+			logger.Fatalf("Aborted without writing any points")
+		}
+		openWriter()
+		if err := staged.writeTo(pw); err != nil {
+			logger.Exitf(exitConnection, "Could not write points: %s", err)
+		}
 		if err := pw.Flush(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Could not write points: %s.\n", err)
-			os.Exit(1)
+			logger.Exitf(exitConnection, "Could not write points: %s", err)
+		}
+	}
+
+	if c.manifest != nil && !*o.dryRun {
+		if err := c.manifest.save(); err != nil {
+			logger.Fatalf("Unable to save test manifest %s: %s", *o.testManifestFile, err)
+		}
+	}
+
+	if closer, ok := pw.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Fatalf("Could not close output: %s", err)
+		}
+	}
+
+	if progress != nil {
+		progress.summary()
+	}
+
+	if *o.githubJobSummary {
+		if err := c.writeGitHubJobSummary(queryURL); err != nil {
+			logger.Warnf("Could not write the job summary: %s", err)
+		}
+	}
+
+	if *o.summaryMarkdown != "" {
+		if err := writeSummaryFile(c, o, queryURL); err != nil {
+			logger.Warnf("Could not write the markdown summary: %s", err)
+		}
+	}
+
+	if *o.githubCheck && !*o.dryRun {
+		token := *o.githubToken
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		detailsURL := *o.githubCheckURL
+		if detailsURL == "" {
+			detailsURL = queryURL
+		}
+		client, err := o.conn.httpClient()
+		if err == nil {
+			err = c.writeGitHubCheck(newGitHubAPI(client, token), *o.githubCheckName, detailsURL)
+		}
+		if err != nil {
+			logger.Warnf("Could not write the github check run: %s", err)
+		}
+	}
+
+	if *o.grafanaURL != "" && !*o.dryRun {
+		client, err := o.conn.httpClient()
+		if err == nil {
+			err = c.postGrafanaAnnotation(client, *o.grafanaURL, *o.grafanaToken, queryURL, now)
+		}
+		if err != nil {
+			logger.Warnf("Could not create the grafana annotation: %s", err)
+		}
+	}
+
+	if *o.notifyWebhook != "" && !*o.dryRun {
+		client, err := o.conn.httpClient()
+		if err == nil {
+			err = c.notify(client, *o.notifyWebhook, *o.notifyFormat, *o.notifyThreshold, queryURL)
 		}
+		if err != nil {
+			logger.Warnf("Could not send the notification: %s", err)
+		}
+	}
+
+	if counter != nil {
+		if err := writeRunStats(*o.statsJSON, c, counter, len(files), parseErrs+writeErrs, messages, time.Since(started)); err != nil {
+			logger.Warnf("Could not write the run statistics: %s", err)
+		}
+	}
+
+	if failed := parseErrs + writeErrs; failed > 0 {
+		code := exitParse
+		if writeErrs > 0 {
+			code = exitPartialWrite
+			if written == 0 {
+				code = exitConnection
+			}
+		}
+		logger.Exitf(code, "Could not write %d of %d reports", failed, len(files))
+	}
+	checkGates(c)
+}
+
+// writeRegressions writes the points for the testcases that slowed down
+// compared with the baseline branch. The comparison is skipped when the
+// baseline cannot be read.
+func writeRegressions(c *converter, pw PointsWriter, o *ingestOptions, now time.Time) error {
+	client, err := o.conn.newClient()
+	if err != nil {
+		logger.Warnf("Could not create HTTP client: %s", err)
+		return nil
+	}
+	defer client.Close()
+	baseline, err := queryDurationBaseline(client, o.conn.database, o.conn.retentionPolicy, *o.measurement, *o.regressionBaseline, *o.regressionWindow, c.durationScale)
+	if err != nil {
+		logger.Warnf("Could not read the durations of %s: %s", *o.regressionBaseline, err)
+		return nil
+	}
+	return c.writeRegressions(pw, *o.regressionMeasurement, *o.regressionBaseline, baseline, *o.regressionFactor, now)
+}
+
+// writeSummaryFile writes the markdown summary to the file named by the
+// options. The history of the branch to compare with is left out when it
+// cannot be read.
+func writeSummaryFile(c *converter, o *ingestOptions, queryURL string) error {
+	var history *branchHistory
+	if *o.summaryCompareBranch != "" {
+		if strings.Contains(*o.measurement, "{") {
+			logger.Warnf("Cannot compare with %s when the measurement is a template", *o.summaryCompareBranch)
+		} else if client, err := o.conn.newClient(); err != nil {
+			logger.Warnf("Could not create HTTP client: %s", err)
+		} else {
+			history, err = queryBranchHistory(client, o.conn.database, o.conn.retentionPolicy, *o.measurement, *o.summaryCompareBranch, c.durationScale)
+			if err != nil {
+				logger.Warnf("Could not read the results of %s: %s", *o.summaryCompareBranch, err)
+			}
+			client.Close()
+		}
+	}
+
+	if *o.summaryMarkdown == "-" {
+		return c.writeMarkdownSummary(os.Stdout, history, queryURL)
 	}
+	f, err := os.Create(*o.summaryMarkdown)
+	if err != nil {
+		return err
+	}
+	if err := c.writeMarkdownSummary(f, history, queryURL); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newIngestWriter returns the writer selected by the options along with a
+// description of where it writes and the url to query the points written
+// to influxdb, which is empty for the other writers.
+func newIngestWriter(o *ingestOptions, c *converter, precision string) (pw PointsWriter, target, queryURL string) {
+	target = ingestTarget(o)
+	if *o.dryRun {
+		if !*o.print && *o.output == "" && *o.outputFormat == "" && *o.writerPlugin == "" && *o.honeycombDataset == "" {
+			if err := o.conn.check(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		}
+		pw = newDryRunPointsWriter(os.Stdout, precision)
+	} else if *o.print || *o.output != "" || *o.outputFormat != "" {
+		format := *o.outputFormat
+		if *o.print && format == "" {
+			format = "line"
+		}
+		w, err := newOutputPointsWriter(*o.output, format, precision, *o.csvColumns)
+		if err != nil {
+			logger.Fatalf("Unable to create output: %s", err)
+		}
+		pw = w
+	} else if *o.writerPlugin != "" {
+		w, err := newPluginPointsWriter(*o.writerPlugin, *o.writerPluginArgs, *o.writerPluginFormat, precision)
+		if err != nil {
+			logger.Fatalf("Could not start writer plugin: %s", err)
+		}
+		pw = w
+	} else if *o.honeycombDataset != "" {
+		apiKey := *o.honeycombAPIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("HONEYCOMB_API_KEY")
+		}
+		if apiKey == "" {
+			logger.Exitf(exitUsage, "Must specify a honeycomb api key")
+		}
+		pw = newHoneycombPointsWriter(*o.honeycombAPIHost, apiKey, *o.honeycombDataset)
+	} else {
+		if o.conn.createDatabase {
+			if err := o.conn.ensureDatabase(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		} else if o.conn.createBucket {
+			if err := o.conn.ensureBucket(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		}
+		if *o.check {
+			if err := o.conn.check(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		}
+		w, err := newInfluxdbPointsWriter(o.conn, influxdb.BatchPointsConfig{
+			Precision:       precision,
+			Database:        o.conn.database,
+			RetentionPolicy: o.conn.retentionPolicy,
+		})
+		if err != nil {
+			logger.Exitf(exitConnection, "Could not create HTTP client: %s", err)
+		}
+		pw = w
+		if !strings.Contains(*o.measurement, "{") {
+			queryURL = influxQueryURL(o.conn.host, o.conn.database, *o.measurement, c.tags)
+		}
+	}
+	return pw, target, queryURL
+}
+
+// ingestTarget describes where the points are written with the options. It
+// is empty for a dry run.
+func ingestTarget(o *ingestOptions) string {
+	switch {
+	case *o.dryRun:
+		return ""
+	case *o.print || *o.output != "" || *o.outputFormat != "":
+		if *o.output == "" {
+			return "stdout"
+		}
+		return *o.output
+	case *o.writerPlugin != "":
+		return *o.writerPlugin
+	case *o.honeycombDataset != "":
+		return "honeycomb dataset " + *o.honeycombDataset
+	default:
+		return o.conn.host
+	}
+}
+
+// ingestFile reads a report and writes its points. The run totals are left
+// unchanged if the report cannot be converted.
+func ingestFile(c *converter, pw PointsWriter, buf *bufferedPointsWriter, path string, now time.Time) error {
+	tests, err := readTestSuitesFile(path)
+	if err != nil {
+		return &exitCodeError{code: exitParse, err: err}
+	}
+	logger.Debug("Read report", "file", path, "suites", len(tests.Items))
+	return ingestReport(c, pw, buf, tests, path, now)
+}
+
+// ingestReport writes the points of a report that has already been read.
+func ingestReport(c *converter, pw PointsWriter, buf *bufferedPointsWriter, tests *TestSuites, path string, now time.Time) error {
+	run, points := c.run, c.points
+	if err := c.writeTestSuites(buf, tests, path, now); err != nil {
+		c.run, c.points = run, points
+		buf.points = buf.points[:0]
+		code := exitParse
+		if c.series.exceeded {
+			code = exitSeriesLimit
+		}
+		return &exitCodeError{code: code, err: fmt.Errorf("%s: %s", path, err)}
+	}
+	if err := buf.writeTo(pw); err != nil {
+		return &exitCodeError{code: exitConnection, err: fmt.Errorf("Could not write points: %s", err)}
+	}
+
+	start := time.Now()
+	if err := pw.Flush(); err != nil {
+		return &exitCodeError{code: exitConnection, err: fmt.Errorf("Could not write points for %s: %s", path, err)}
+	}
+	logger.Info("Wrote report", "file", path, "points", c.points-points, "elapsed", time.Since(start))
+	return nil
 }
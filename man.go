@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// genMan writes a man page for the tool to stdout. It is generated from
+// the commands and their options so it does not need to be kept up to date
+// by hand.
+func genMan(args []string) {
+	fs := pflag.NewFlagSet("gen-man", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "gen-man")
+	fs.Parse(args)
+	writeMan(os.Stdout)
+}
+
+func writeMan(w io.Writer) {
+	v, _, d := buildVersion()
+	if len(d) > 10 {
+		d = d[:10]
+	}
+	fmt.Fprintf(w, ".TH INFLUX\\-JUNIT 1 %q %q \"User Commands\"\n", d, strings.TrimSpace("influx-junit "+v))
+	fmt.Fprintf(w, ".SH NAME\ninflux\\-junit \\- write junit test reports to influxdb\n")
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B influx\\-junit\n[\\fIcommand\\fR] [\\fIoptions\\fR] \\fIfile\\fR...\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\nReads junit xml reports and writes a point for each testcase to influxdb or another output. The ingest command is used when no command is given.\n")
+
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, cmd := range commands {
+		if cmd.hidden {
+			continue
+		}
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(cmd.name), roffEscape(cmd.summary))
+	}
+
+	for _, cmd := range commands {
+		flags := commandFlags(cmd)
+		if cmd.hidden || len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, ".SH %s OPTIONS\n", strings.ToUpper(roffEscape(cmd.name)))
+		for _, f := range flags {
+			name, usage := pflag.UnquoteUsage(f)
+			fmt.Fprintf(w, ".TP\n")
+			if f.Shorthand != "" {
+				fmt.Fprintf(w, "\\fB\\-%s\\fR, ", f.Shorthand)
+			}
+			fmt.Fprintf(w, "\\fB\\-\\-%s\\fR", roffEscape(f.Name))
+			if name != "" {
+				fmt.Fprintf(w, " \\fI%s\\fR", roffEscape(name))
+			}
+			fmt.Fprintf(w, "\n%s", roffEscape(usage))
+			if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "[]" && f.DefValue != "0s" {
+				fmt.Fprintf(w, " (default %s)", roffEscape(f.DefValue))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	fmt.Fprintf(w, ".SH ENVIRONMENT\nEvery option of the ingest command can be set with an environment variable named after the option with the %s prefix, such as %sDATABASE.\n",
+		roffEscape(envPrefix), roffEscape(envPrefix))
+
+	fmt.Fprintf(w, ".SH EXIT STATUS\n")
+	for _, e := range []struct {
+		code int
+		desc string
+	}{
+		{0, "all of the reports were written"},
+		{exitFailure, "an unexpected error"},
+		{exitUsage, "invalid options or config file"},
+		{exitParse, "a report could not be read or converted"},
+		{exitConnection, "no points could be written to the server"},
+		{exitPartialWrite, "only some of the points could be written to the server"},
+		{exitGate, "the run failed a --fail-if condition"},
+		{exitSeriesLimit, "the run stopped at the --max-series limit"},
+	} {
+		fmt.Fprintf(w, ".TP\n.B %d\n%s\n", e.code, e.desc)
+	}
+}
+
+// roffEscape escapes text so it is not interpreted as roff requests.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
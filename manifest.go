@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// testKey identifies a testcase across runs.
+type testKey struct {
+	Suite     string `json:"suite"`
+	ClassName string `json:"classname,omitempty"`
+	Name      string `json:"name"`
+}
+
+// testManifest tracks the set of testcases in a run so it can be compared
+// with the set stored by the previous run.
+type testManifest struct {
+	path     string
+	previous map[testKey]bool
+	current  map[testKey]bool
+
+	// incomplete is set when a report of the run could not be converted
+	// or written, so the tests missing from the run may still exist.
+	incomplete bool
+}
+
+type testManifestFile struct {
+	Tests []testKey `json:"tests"`
+}
+
+// readTestManifest reads the manifest stored at the path. The previous set
+// of testcases is nil if the manifest does not exist yet.
+func readTestManifest(path string) (*testManifest, error) {
+	m := &testManifest{
+		path:    path,
+		current: make(map[testKey]bool),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f testManifestFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	m.previous = make(map[testKey]bool, len(f.Tests))
+	for _, key := range f.Tests {
+		m.previous[key] = true
+	}
+	return m, nil
+}
+
+func (m *testManifest) add(testsuite *TestSuite, testcase *TestCase) {
+	m.current[testKey{
+		Suite:     testsuite.Name,
+		ClassName: testcase.ClassName,
+		Name:      testcase.Name,
+	}] = true
+}
+
+// save replaces the stored manifest with the testcases of this run. The
+// testcases of the previous run are kept when the run is incomplete.
+func (m *testManifest) save() error {
+	tests := m.current
+	if m.incomplete {
+		tests = make(map[testKey]bool, len(m.current)+len(m.previous))
+		for key := range m.previous {
+			tests[key] = true
+		}
+		for key := range m.current {
+			tests[key] = true
+		}
+	}
+	f := testManifestFile{Tests: sortedTestKeys(tests)}
+	data, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run does not
+	// leave a truncated manifest behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), ".manifest")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// writeTestChanges writes a new_test point for each testcase that was not
+// in the previous run and a removed_test point for each testcase that is no
+// longer in this run. Nothing is written when there was no previous run,
+// and no removed_test points are written when the run is incomplete.
+func (c *converter) writeTestChanges(pw PointsWriter, measurement string, now time.Time) error {
+	m := c.manifest
+	if m.previous == nil {
+		return nil
+	}
+	for _, key := range sortedTestKeys(m.current) {
+		if !m.previous[key] {
+			if err := c.writeTestChange(pw, measurement, key, "new_test", now); err != nil {
+				return err
+			}
+		}
+	}
+	if m.incomplete {
+		return nil
+	}
+	for _, key := range sortedTestKeys(m.previous) {
+		if !m.current[key] {
+			if err := c.writeTestChange(pw, measurement, key, "removed_test", now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *converter) writeTestChange(pw PointsWriter, measurement string, key testKey, change string, now time.Time) error {
+	tags := map[string]string{
+		"suite_name": key.Suite,
+		"test_name":  key.Name,
+	}
+	if c.classNameTag && key.ClassName != "" {
+		tags["classname"] = key.ClassName
+	}
+	fields := map[string]interface{}{
+		change: true,
+	}
+	return c.writePoint(pw, measurement, newTemplateData(nil, nil), tags, fields, now)
+}
+
+func sortedTestKeys(set map[testKey]bool) []testKey {
+	keys := make([]testKey, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Suite != b.Suite {
+			return a.Suite < b.Suite
+		}
+		if a.ClassName != b.ClassName {
+			return a.ClassName < b.ClassName
+		}
+		return a.Name < b.Name
+	})
+	return keys
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// schemaMapping describes how the testcase and testsuite points are built
+// from a report. It is read from a YAML file such as:
+//
+//	testcase:
+//	  measurement: junit_test_results
+//	  tags:
+//	    suite_name: suite.name
+//	    test_name: test.name
+//	    os: property.os
+//	  fields:
+//	    duration: {source: test.time, type: float}
+//	    build: {source: property.build_number, type: int}
+//	suite:
+//	  measurement: junit_suite_results
+//	  tags:
+//	    suite_name: suite.name
+//	  fields:
+//	    tests: suite.tests
+//
+// Each tag and field names its source: an attribute of the testsuite
+// (suite.<name>) or testcase (test.<name>), a testsuite property
+// (property.<name>), or an environment variable (env.<name>). The testcase
+// also has the status, failure.message, failure.type, and skipped.message
+// sources. Fields may convert the value to a float, int, bool, or string
+// and otherwise the type is inferred. Values that are missing are omitted.
+type schemaMapping struct {
+	testcase *pointMapping
+	suite    *pointMapping
+}
+
+// pointMapping replaces the default tags and fields of a point.
+type pointMapping struct {
+	measurement string
+	tags        []tagMapping
+	fields      []fieldMapping
+}
+
+type tagMapping struct {
+	name   string
+	source string
+}
+
+type fieldMapping struct {
+	name   string
+	source string
+	typ    string
+}
+
+func readSchemaMapping(path string) (*schemaMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaMapping(v)
+}
+
+func parseSchemaMapping(v interface{}) (*schemaMapping, error) {
+	m, err := yamlMap(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping schemaMapping
+	for key, value := range m {
+		pm, err := parsePointMapping(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		switch key {
+		case "testcase":
+			mapping.testcase = pm
+		case "suite":
+			mapping.suite = pm
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return &mapping, nil
+}
+
+func parsePointMapping(v interface{}) (*pointMapping, error) {
+	m, err := yamlMap(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var pm pointMapping
+	for key, value := range m {
+		switch key {
+		case "measurement":
+			if pm.measurement, err = yamlString(value); err != nil {
+				return nil, fmt.Errorf("measurement: %s", err)
+			}
+		case "tags":
+			tags, err := yamlMap(value)
+			if err != nil {
+				return nil, fmt.Errorf("tags: %s", err)
+			}
+			for name, source := range tags {
+				s, err := yamlString(source)
+				if err != nil {
+					return nil, fmt.Errorf("tags: %s: %s", name, err)
+				}
+				if err := validateSource(s); err != nil {
+					return nil, fmt.Errorf("tags: %s: %s", name, err)
+				}
+				pm.tags = append(pm.tags, tagMapping{name: name, source: s})
+			}
+		case "fields":
+			fields, err := yamlMap(value)
+			if err != nil {
+				return nil, fmt.Errorf("fields: %s", err)
+			}
+			for name, spec := range fields {
+				fm, err := parseFieldMapping(name, spec)
+				if err != nil {
+					return nil, fmt.Errorf("fields: %s: %s", name, err)
+				}
+				pm.fields = append(pm.fields, fm)
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return &pm, nil
+}
+
+func parseFieldMapping(name string, v interface{}) (fieldMapping, error) {
+	fm := fieldMapping{name: name}
+	if s, ok := v.(string); ok {
+		fm.source = s
+	} else {
+		m, err := yamlMap(v)
+		if err != nil {
+			return fieldMapping{}, err
+		}
+		for key, value := range m {
+			s, err := yamlString(value)
+			if err != nil {
+				return fieldMapping{}, fmt.Errorf("%s: %s", key, err)
+			}
+			switch key {
+			case "source":
+				fm.source = s
+			case "type":
+				fm.typ = s
+			default:
+				return fieldMapping{}, fmt.Errorf("unknown key %q", key)
+			}
+		}
+	}
+
+	switch fm.typ {
+	case "", "float", "int", "bool", "string":
+	default:
+		return fieldMapping{}, fmt.Errorf("unknown type %q", fm.typ)
+	}
+	return fm, validateSource(fm.source)
+}
+
+func validateSource(source string) error {
+	i := strings.IndexByte(source, '.')
+	if i < 0 {
+		return fmt.Errorf("invalid source %q", source)
+	}
+	switch source[:i] {
+	case "suite", "test", "property", "env":
+		return nil
+	default:
+		return fmt.Errorf("invalid source %q", source)
+	}
+}
+
+// mapTags returns the mapped tags for a point.
+func (pm *pointMapping) mapTags(testsuite *TestSuite, testcase *TestCase) map[string]string {
+	tags := make(map[string]string, len(pm.tags))
+	for _, t := range pm.tags {
+		if v, ok := lookupSource(t.source, testsuite, testcase); ok && v != "" {
+			tags[t.name] = v
+		}
+	}
+	return tags
+}
+
+// mapFields returns the mapped fields for a point converted to the
+// configured types.
+func (pm *pointMapping) mapFields(testsuite *TestSuite, testcase *TestCase) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(pm.fields))
+	for _, f := range pm.fields {
+		v, ok := lookupSource(f.source, testsuite, testcase)
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch f.typ {
+		case "float":
+			fields[f.name], err = strconv.ParseFloat(v, 64)
+		case "int":
+			fields[f.name], err = strconv.ParseInt(v, 10, 64)
+		case "bool":
+			fields[f.name], err = strconv.ParseBool(v)
+		case "string":
+			fields[f.name] = v
+		default:
+			fields[f.name] = parseFieldValue(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not convert field %s: %s", f.name, err)
+		}
+	}
+	return fields, nil
+}
+
+// lookupSource returns the value of a mapping source. The testcase is nil
+// for testsuite points.
+func lookupSource(source string, testsuite *TestSuite, testcase *TestCase) (string, bool) {
+	i := strings.IndexByte(source, '.')
+	kind, name := source[:i], source[i+1:]
+	switch kind {
+	case "suite":
+		return suiteAttr(testsuite, name)
+	case "test":
+		if testcase == nil {
+			return "", false
+		}
+		return testAttr(testcase, name)
+	case "property":
+		for _, p := range testsuite.Properties.Items {
+			if p.Name == name {
+				return p.Value, true
+			}
+		}
+	case "env":
+		return os.LookupEnv(name)
+	}
+	return "", false
+}
+
+func suiteAttr(testsuite *TestSuite, name string) (string, bool) {
+	switch name {
+	case "name":
+		return testsuite.Name, true
+	case "tests":
+		return strconv.Itoa(testsuite.Tests), true
+	case "failures":
+		return strconv.Itoa(testsuite.Failures), true
+	case "errors":
+		return strconv.Itoa(testsuite.Errors), true
+	case "skipped":
+		return strconv.Itoa(testsuite.Skipped), true
+	case "time":
+		return strconv.FormatFloat(testsuite.Duration, 'f', -1, 64), true
+	case "timestamp":
+		return testsuite.Timestamp, testsuite.Timestamp != ""
+	}
+	return lookupAttr(testsuite.Attrs, name)
+}
+
+func testAttr(testcase *TestCase, name string) (string, bool) {
+	switch name {
+	case "name":
+		return testcase.Name, true
+	case "classname":
+		return testcase.ClassName, true
+	case "time":
+		return strconv.FormatFloat(testcase.Duration, 'f', -1, 64), true
+	case "status":
+		return testcase.Status(), true
+	case "failure.message", "failure.type":
+		f := testcase.Failure
+		if testcase.Error != nil {
+			f = testcase.Error
+		}
+		if f == nil {
+			return "", false
+		}
+		if name == "failure.message" {
+			return f.Message, true
+		}
+		return f.Type, true
+	case "skipped.message":
+		if testcase.Skipped == nil {
+			return "", false
+		}
+		return testcase.Skipped.Message, true
+	}
+	return lookupAttr(testcase.Attrs, name)
+}
+
+func lookupAttr(attrs []xml.Attr, name string) (string, bool) {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// writeLatencyBuckets are the upper bounds in seconds of the write latency
+// histogram.
+var writeLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// serverMetrics counts what the serve command has done so it can be
+// scraped by prometheus from /metrics.
+type serverMetrics struct {
+	mu            sync.Mutex
+	uploads       map[int]int
+	reports       int
+	parseErrors   int
+	points        int
+	writes        int
+	writeErrors   int
+	retries       int
+	latencyCounts []int
+	latencySum    float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		uploads:       make(map[int]int),
+		latencyCounts: make([]int, len(writeLatencyBuckets)),
+	}
+}
+
+// instrument counts the responses of the handler by status code.
+func (m *serverMetrics) instrument(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h(sw, r)
+		m.mu.Lock()
+		m.uploads[sw.code]++
+		m.mu.Unlock()
+	}
+}
+
+func (m *serverMetrics) addReports(n int) {
+	m.mu.Lock()
+	m.reports += n
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) addParseError() {
+	m.mu.Lock()
+	m.parseErrors++
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) addPoints(n int) {
+	m.mu.Lock()
+	m.points += n
+	m.mu.Unlock()
+}
+
+// addWrite records a write to influxdb with the stats of its writer.
+func (m *serverMetrics) addWrite(stats sendStats, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes++
+	m.retries += stats.retries
+	if err != nil {
+		m.writeErrors++
+		return
+	}
+	latency := stats.last.Seconds()
+	m.latencySum += latency
+	for i, bound := range writeLatencyBuckets {
+		if latency <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+}
+
+// writeTo writes the metrics in the prometheus text format. The number of
+// writes stored in the write-ahead log is given by walPending and is left
+// out when it is negative.
+func (m *serverMetrics) writeTo(w io.Writer, walPending int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := func(name, help string, v int) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+
+	fmt.Fprintf(w, "# HELP influx_junit_uploads_total Uploads received by response status code.\n# TYPE influx_junit_uploads_total counter\n")
+	codes := make([]int, 0, len(m.uploads))
+	for code := range m.uploads {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "influx_junit_uploads_total{code=\"%d\"} %d\n", code, m.uploads[code])
+	}
+	counter("influx_junit_reports_received_total", "Reports received in uploads.", m.reports)
+	counter("influx_junit_parse_errors_total", "Uploads with a report that could not be read or converted.", m.parseErrors)
+	counter("influx_junit_points_written_total", "Points written to influxdb.", m.points)
+	counter("influx_junit_writes_total", "Writes to influxdb.", m.writes)
+	counter("influx_junit_write_errors_total", "Writes to influxdb that failed after any retries.", m.writeErrors)
+	counter("influx_junit_write_retries_total", "Retried writes to influxdb.", m.retries)
+
+	fmt.Fprintf(w, "# HELP influx_junit_write_duration_seconds Latency of the successful writes to influxdb.\n# TYPE influx_junit_write_duration_seconds histogram\n")
+	total := m.writes - m.writeErrors
+	for i, bound := range writeLatencyBuckets {
+		fmt.Fprintf(w, "influx_junit_write_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "influx_junit_write_duration_seconds_bucket{le=\"+Inf\"} %d\n", total)
+	fmt.Fprintf(w, "influx_junit_write_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "influx_junit_write_duration_seconds_count %d\n", total)
+
+	if walPending >= 0 {
+		fmt.Fprintf(w, "# HELP influx_junit_wal_pending Writes stored in the write-ahead log.\n# TYPE influx_junit_wal_pending gauge\ninflux_junit_wal_pending %d\n", walPending)
+	}
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
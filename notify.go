@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxNotifyTests is the number of failed testcases listed in a
+// notification.
+const maxNotifyTests = 20
+
+// notify posts a summary of the run to a webhook when at least threshold
+// testcases failed or had an error. The slack format posts a message for a
+// slack incoming webhook and the json format posts the totals and the
+// failed testcases.
+func (c *converter) notify(client *http.Client, webhookURL, format string, threshold int, link string) error {
+	if c.failedCount() < threshold {
+		return nil
+	}
+
+	var payload interface{}
+	switch format {
+	case "slack":
+		payload = map[string]string{"text": c.notifyText(link)}
+	case "json":
+		payload = map[string]interface{}{
+			"status":       c.runStatus(),
+			"tests":        c.run.tests,
+			"failures":     c.run.failures,
+			"errors":       c.run.errors,
+			"skipped":      c.run.skipped,
+			"failed_tests": c.run.failed,
+			"tags":         c.tags,
+			"url":          link,
+		}
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// failedCount returns the number of testcases that failed or had an error.
+// The testcases are counted when the totals in the report are too low.
+func (c *converter) failedCount() int {
+	n := c.run.failures + c.run.errors
+	if len(c.run.failed) > n {
+		n = len(c.run.failed)
+	}
+	return n
+}
+
+// notifyText returns the slack message for the run.
+func (c *converter) notifyText(link string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "*%d of %d tests failed* (%s)", c.failedCount(), c.run.tests, c.runText())
+	for _, k := range []string{"branch", "build_number"} {
+		if v := c.tags[k]; v != "" {
+			fmt.Fprintf(&buf, " %s: `%s`", k, v)
+		}
+	}
+	buf.WriteString("\n")
+	for i, key := range c.run.failed {
+		if i == maxNotifyTests {
+			fmt.Fprintf(&buf, "…and %d more\n", len(c.run.failed)-i)
+			break
+		}
+		fmt.Fprintf(&buf, "• %s › %s\n", key.Suite, key.Name)
+	}
+	if url, ok := c.fields["build_url"].(string); ok && url != "" {
+		fmt.Fprintf(&buf, "<%s|Build> ", url)
+	}
+	if link != "" {
+		fmt.Fprintf(&buf, "<%s|Results>", link)
+	}
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// suiteOrder records where the first failure of a testsuite happened so the
+// first failure of the run can be found once every report has been read.
+type suiteOrder struct {
+	// start is the timestamp of the testsuite and is zero when the
+	// testsuite does not have a valid one.
+	start time.Time
+
+	tests    int
+	duration float64
+
+	// firstFailure is the index of the first testcase that failed or had
+	// an error, or -1, and firstFailureEnd the seconds from the start of
+	// the testsuite until that testcase finished.
+	firstFailure    int
+	firstFailureEnd float64
+}
+
+// newSuiteOrder records the first failure of the testsuite among the
+// testcases that match the filter. The excluded testcases still count
+// towards the index and the time of the failure since they ran.
+func newSuiteOrder(testsuite *TestSuite, filter *nameFilter) suiteOrder {
+	o := suiteOrder{firstFailure: -1}
+	if testsuite.Timestamp != "" {
+		if t, err := parseSuiteTimestamp(testsuite.Timestamp); err == nil {
+			o.start = t
+		}
+	}
+	for i, testcase := range testsuite.TestCases {
+		o.tests++
+		o.duration += testcase.Duration
+		if o.firstFailure < 0 && (testcase.Failure != nil || testcase.Error != nil) && filter.match(testcase.Name) {
+			o.firstFailure = i
+			o.firstFailureEnd = o.duration
+		}
+	}
+	return o
+}
+
+// firstFailure returns the index of the first testcase of the run that
+// failed or had an error and the seconds from the start of the run until it
+// finished. When every testsuite has a timestamp, the testsuites may have
+// run in parallel so the first failure is the one that finished first and
+// the testcases are indexed in the order their testsuites started.
+// Otherwise the testsuites are treated as running one after another in the
+// order of the reports. It returns false when no testcase failed.
+func (r *runTotals) firstFailure() (int, float64, bool) {
+	suites := append([]suiteOrder(nil), r.order...)
+	timestamps := len(suites) > 0
+	for _, s := range suites {
+		timestamps = timestamps && !s.start.IsZero()
+	}
+	if timestamps {
+		sort.SliceStable(suites, func(i, j int) bool {
+			return suites[i].start.Before(suites[j].start)
+		})
+	}
+
+	var (
+		found             bool
+		firstIndex        int
+		firstEnd, elapsed float64
+		preceding         int
+	)
+	for _, s := range suites {
+		offset := elapsed
+		if timestamps {
+			offset = s.start.Sub(suites[0].start).Seconds()
+		}
+		if s.firstFailure >= 0 && (!found || offset+s.firstFailureEnd < firstEnd) {
+			found = true
+			firstIndex = preceding + s.firstFailure
+			firstEnd = offset + s.firstFailureEnd
+			if !timestamps {
+				break
+			}
+		}
+		preceding += s.tests
+		elapsed += s.duration
+	}
+	return firstIndex, firstEnd, found
+}
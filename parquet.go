@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// The parquet writer below implements just enough of the format to write
+// flat files: every column chunk is a single uncompressed data page with
+// plain encoding. The columns are only known once every point has been
+// seen, so the points are kept until Close writes the file.
+//
+// The file has a column for the time and the measurement of the points, a
+// string column for each tag key, and a column for each field key typed
+// after its values:
+//
+//	time        INT64 (TIMESTAMP_MICROS)
+//	measurement BYTE_ARRAY (UTF8)
+//	<tag>       optional BYTE_ARRAY (UTF8)
+//	<field>     optional DOUBLE, INT64, BOOLEAN, or BYTE_ARRAY (UTF8)
+//
+// A field with both integer and float values is written as a DOUBLE and a
+// field with values of other mixed types is written as text. A field named
+// like a tag or like the time or measurement column has _1 appended.
+
+const parquetMagic = "PAR1"
+
+// parquetRowGroupSize is the largest number of rows in a row group.
+const parquetRowGroupSize = 64 * 1024
+
+// Parquet physical types, repetition types, converted types, and encodings.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetRow holds the values of a point.
+type parquetRow struct {
+	time        int64
+	measurement string
+	tags        map[string]string
+	fields      map[string]interface{}
+}
+
+// parquetColumn is a column of the file. The value of a tag column is read
+// from the tag and the value of a field column from the field.
+type parquetColumn struct {
+	name       string
+	typ        int32
+	repetition int32
+
+	// convertedType is the logical type of the values, if there is one.
+	convertedType int32
+	converted     bool
+
+	tag, field string
+}
+
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	columns []parquetColumnChunk
+}
+
+type parquetPointsWriter struct {
+	w      *bufio.Writer
+	c      io.Closer
+	offset int64
+	rows   []parquetRow
+}
+
+func newParquetPointsWriter(w io.WriteCloser) *parquetPointsWriter {
+	return &parquetPointsWriter{
+		w: bufio.NewWriter(w),
+		c: w,
+	}
+}
+
+func (pw *parquetPointsWriter) Write(pt *influxdb.Point) error {
+	fields, err := pt.Fields()
+	if err != nil {
+		return err
+	}
+	pw.rows = append(pw.rows, parquetRow{
+		time:        pt.UnixNano() / 1000,
+		measurement: pt.Name(),
+		tags:        pt.Tags(),
+		fields:      fields,
+	})
+	return nil
+}
+
+// Flush does nothing since the rows can only be written once the columns
+// are known.
+func (pw *parquetPointsWriter) Flush() error {
+	return nil
+}
+
+// Close writes the file.
+func (pw *parquetPointsWriter) Close() error {
+	if err := pw.writeFile(); err != nil {
+		pw.c.Close()
+		return err
+	}
+	return pw.c.Close()
+}
+
+func (pw *parquetPointsWriter) writeFile() error {
+	columns := parquetColumns(pw.rows)
+	if err := pw.write([]byte(parquetMagic)); err != nil {
+		return err
+	}
+
+	var rowGroups []parquetRowGroup
+	for rows := pw.rows; len(rows) > 0; {
+		n := len(rows)
+		if n > parquetRowGroupSize {
+			n = parquetRowGroupSize
+		}
+		rg, err := pw.writeRowGroup(columns, rows[:n])
+		if err != nil {
+			return err
+		}
+		rowGroups = append(rowGroups, rg)
+		rows = rows[n:]
+	}
+
+	footer := parquetFooter(columns, rowGroups, int64(len(pw.rows)))
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, size[:], []byte(parquetMagic)} {
+		if err := pw.write(b); err != nil {
+			return err
+		}
+	}
+	return pw.w.Flush()
+}
+
+// writeRowGroup writes a data page for each column with the values of the
+// rows.
+func (pw *parquetPointsWriter) writeRowGroup(columns []parquetColumn, rows []parquetRow) (parquetRowGroup, error) {
+	rg := parquetRowGroup{numRows: int64(len(rows))}
+	for _, col := range columns {
+		data := col.encode(rows)
+
+		var e thriftEncoder
+		e.writeI32Field(1, 0) // type = DATA_PAGE
+		e.writeI32Field(2, int32(len(data)))
+		e.writeI32Field(3, int32(len(data)))
+		e.writeStructBegin(5)
+		e.writeI32Field(1, int32(len(rows)))
+		e.writeI32Field(2, parquetPlain)
+		e.writeI32Field(3, parquetRLE) // definition_level_encoding
+		e.writeI32Field(4, parquetRLE) // repetition_level_encoding
+		e.writeStructEnd()
+		e.writeStructEnd()
+
+		chunk := parquetColumnChunk{offset: pw.offset}
+		if err := pw.write(e.buf); err != nil {
+			return rg, err
+		}
+		if err := pw.write(data); err != nil {
+			return rg, err
+		}
+		chunk.size = pw.offset - chunk.offset
+		rg.columns = append(rg.columns, chunk)
+	}
+	return rg, nil
+}
+
+func (pw *parquetPointsWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// parquetColumns returns the columns for the tags and fields of the rows.
+func parquetColumns(rows []parquetRow) []parquetColumn {
+	tags := make(map[string]bool)
+	fields := make(map[string]int32)
+	for _, row := range rows {
+		for k := range row.tags {
+			tags[k] = true
+		}
+		for k, v := range row.fields {
+			typ := parquetFieldType(v)
+			if prev, ok := fields[k]; ok && prev != typ {
+				if (prev == parquetInt64 || prev == parquetDouble) && (typ == parquetInt64 || typ == parquetDouble) {
+					typ = parquetDouble
+				} else {
+					typ = parquetByteArray
+				}
+			}
+			fields[k] = typ
+		}
+	}
+
+	columns := []parquetColumn{
+		{name: "time", typ: parquetInt64, repetition: parquetRequired, convertedType: parquetTimestampMicros, converted: true},
+		{name: "measurement", typ: parquetByteArray, repetition: parquetRequired, convertedType: parquetUTF8, converted: true},
+	}
+	names := map[string]bool{"time": true, "measurement": true}
+	tagKeys := make([]string, 0, len(tags))
+	for k := range tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		name := k
+		for names[name] {
+			name += "_1"
+		}
+		names[name] = true
+		columns = append(columns, parquetColumn{name: name, typ: parquetByteArray, repetition: parquetOptional, convertedType: parquetUTF8, converted: true, tag: k})
+	}
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for _, k := range fieldKeys {
+		name := k
+		for names[name] {
+			name += "_1"
+		}
+		names[name] = true
+		col := parquetColumn{name: name, typ: fields[k], repetition: parquetOptional, field: k}
+		if col.typ == parquetByteArray {
+			col.convertedType, col.converted = parquetUTF8, true
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// parquetFieldType returns the physical type for a field value.
+func parquetFieldType(v interface{}) int32 {
+	switch v.(type) {
+	case float64:
+		return parquetDouble
+	case int64, uint64:
+		return parquetInt64
+	case bool:
+		return parquetBoolean
+	default:
+		return parquetByteArray
+	}
+}
+
+// value returns the value of the column in the row and whether it is set.
+func (col *parquetColumn) value(row *parquetRow) (interface{}, bool) {
+	switch {
+	case col.tag != "":
+		v, ok := row.tags[col.tag]
+		return v, ok
+	case col.field != "":
+		v, ok := row.fields[col.field]
+		return v, ok
+	case col.name == "time":
+		return row.time, true
+	default:
+		return row.measurement, true
+	}
+}
+
+// encode returns the contents of the data page with the values of the
+// column in the rows. The values of an optional column are preceded by
+// their definition levels and the values that are not set are left out.
+func (col *parquetColumn) encode(rows []parquetRow) []byte {
+	var (
+		data    []byte
+		defined = make([]bool, len(rows))
+		bits    []bool
+	)
+	for i := range rows {
+		v, ok := col.value(&rows[i])
+		defined[i] = ok
+		if !ok {
+			continue
+		}
+		switch col.typ {
+		case parquetInt64:
+			var n int64
+			switch v := v.(type) {
+			case int64:
+				n = v
+			case uint64:
+				n = int64(v)
+			}
+			data = binary.LittleEndian.AppendUint64(data, uint64(n))
+		case parquetDouble:
+			var f float64
+			switch v := v.(type) {
+			case float64:
+				f = v
+			case int64:
+				f = float64(v)
+			case uint64:
+				f = float64(v)
+			}
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(f))
+		case parquetBoolean:
+			bits = append(bits, v.(bool))
+		default:
+			s, ok := v.(string)
+			if !ok {
+				s = formatFieldValue(v)
+			}
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(s)))
+			data = append(data, s...)
+		}
+	}
+	if col.typ == parquetBoolean {
+		data = appendParquetBits(data, bits)
+	}
+	if col.repetition == parquetRequired {
+		return data
+	}
+	return append(appendParquetLevels(nil, defined), data...)
+}
+
+// appendParquetBits appends the bits packed from the least significant bit
+// of each byte, which is the plain encoding of booleans.
+func appendParquetBits(dst []byte, bits []bool) []byte {
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8 && i+j < len(bits); j++ {
+			if bits[i+j] {
+				b |= 1 << uint(j)
+			}
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// appendParquetLevels appends the definition levels of an optional column
+// with the rle hybrid encoding, as one rle run for each run of rows that
+// are all set or all unset, preceded by the length of the runs.
+func appendParquetLevels(dst []byte, defined []bool) []byte {
+	var runs []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		runs = binary.AppendUvarint(runs, uint64(j-i)<<1)
+		if defined[i] {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, 0)
+		}
+		i = j
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(runs)))
+	return append(dst, runs...)
+}
+
+// parquetFooter returns the file metadata.
+func parquetFooter(columns []parquetColumn, rowGroups []parquetRowGroup, numRows int64) []byte {
+	var e thriftEncoder
+	e.writeI32Field(1, 1) // version
+	e.writeListBegin(2, thriftStruct, len(columns)+1)
+	e.beginStruct()
+	e.writeBinaryField(4, "schema")
+	e.writeI32Field(5, int32(len(columns)))
+	e.writeStructEnd()
+	for _, col := range columns {
+		e.beginStruct()
+		e.writeI32Field(1, col.typ)
+		e.writeI32Field(3, col.repetition)
+		e.writeBinaryField(4, col.name)
+		if col.converted {
+			e.writeI32Field(6, col.convertedType)
+		}
+		e.writeStructEnd()
+	}
+	e.writeI64Field(3, numRows)
+	e.writeListBegin(4, thriftStruct, len(rowGroups))
+	for _, rg := range rowGroups {
+		var totalSize int64
+		e.beginStruct()
+		e.writeListBegin(1, thriftStruct, len(rg.columns))
+		for i, chunk := range rg.columns {
+			col := columns[i]
+			e.beginStruct()
+			e.writeI64Field(2, chunk.offset)
+			e.writeStructBegin(3)
+			e.writeI32Field(1, col.typ)
+			e.writeListBegin(2, thriftI32, 2)
+			e.writeZigzag(parquetPlain)
+			e.writeZigzag(parquetRLE)
+			e.writeListBegin(3, thriftBinary, 1)
+			e.writeBinary(col.name)
+			e.writeI32Field(4, 0) // codec = UNCOMPRESSED
+			e.writeI64Field(5, rg.numRows)
+			e.writeI64Field(6, chunk.size)
+			e.writeI64Field(7, chunk.size)
+			e.writeI64Field(9, chunk.offset)
+			e.writeStructEnd()
+			e.writeStructEnd()
+			totalSize += chunk.size
+		}
+		e.writeI64Field(2, totalSize)
+		e.writeI64Field(3, rg.numRows)
+		e.writeStructEnd()
+	}
+	e.writeBinaryField(6, "influx-junit")
+	e.writeStructEnd()
+	return e.buf
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftEncoder writes the subset of the thrift compact protocol needed for
+// the parquet metadata structures.
+type thriftEncoder struct {
+	buf     []byte
+	lastID  int16
+	idStack []int16
+}
+
+func (e *thriftEncoder) writeVarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	e.buf = append(e.buf, buf[:n]...)
+}
+
+func (e *thriftEncoder) writeZigzag(v int64) {
+	e.writeVarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (e *thriftEncoder) writeFieldHeader(id int16, typ byte) {
+	if delta := id - e.lastID; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.writeZigzag(int64(id))
+	}
+	e.lastID = id
+}
+
+func (e *thriftEncoder) writeI32Field(id int16, v int32) {
+	e.writeFieldHeader(id, thriftI32)
+	e.writeZigzag(int64(v))
+}
+
+func (e *thriftEncoder) writeI64Field(id int16, v int64) {
+	e.writeFieldHeader(id, thriftI64)
+	e.writeZigzag(v)
+}
+
+func (e *thriftEncoder) writeBinary(s string) {
+	e.writeVarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *thriftEncoder) writeBinaryField(id int16, s string) {
+	e.writeFieldHeader(id, thriftBinary)
+	e.writeBinary(s)
+}
+
+func (e *thriftEncoder) writeStructBegin(id int16) {
+	e.writeFieldHeader(id, thriftStruct)
+	e.beginStruct()
+}
+
+// beginStruct starts a nested struct that is not itself a field, such as
+// an element of a list.
+func (e *thriftEncoder) beginStruct() {
+	e.idStack = append(e.idStack, e.lastID)
+	e.lastID = 0
+}
+
+// writeListBegin writes the header for a list field. The elements are
+// written directly after it; struct elements are each wrapped in
+// beginStruct and writeStructEnd.
+func (e *thriftEncoder) writeListBegin(id int16, elemType byte, size int) {
+	e.writeFieldHeader(id, thriftList)
+	if size < 15 {
+		e.buf = append(e.buf, byte(size)<<4|elemType)
+	} else {
+		e.buf = append(e.buf, 0xf0|elemType)
+		e.writeVarint(uint64(size))
+	}
+}
+
+// writeStructEnd terminates the current struct and restores the field id
+// state of the enclosing struct.
+func (e *thriftEncoder) writeStructEnd() {
+	e.buf = append(e.buf, 0)
+	if n := len(e.idStack); n > 0 {
+		e.lastID = e.idStack[n-1]
+		e.idStack = e.idStack[:n-1]
+		return
+	}
+	e.lastID = 0
+}
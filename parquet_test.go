@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+type closeBuffer struct {
+	bytes.Buffer
+}
+
+func (*closeBuffer) Close() error { return nil }
+
+// thriftDecoder reads the thrift compact protocol. Structs are returned as
+// a map of the field ids to the values and lists as slices.
+type thriftDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *thriftDecoder) varint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	d.pos += n
+	return v
+}
+
+func (d *thriftDecoder) zigzag() int64 {
+	v := d.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *thriftDecoder) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case thriftI32, thriftI64:
+		return d.zigzag()
+	case thriftBinary:
+		n := int(d.varint())
+		s := string(d.buf[d.pos : d.pos+n])
+		d.pos += n
+		return s
+	case thriftList:
+		header := d.buf[d.pos]
+		d.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(d.varint())
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			items[i] = d.value(header & 0xf)
+		}
+		return items
+	case thriftStruct:
+		return d.structure()
+	default:
+		panic(fmt.Sprintf("unsupported thrift type %d", typ))
+	}
+}
+
+func (d *thriftDecoder) structure() map[int64]interface{} {
+	fields := make(map[int64]interface{})
+	var id int64
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		if delta := int64(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = d.zigzag()
+		}
+		fields[id] = d.value(header & 0xf)
+	}
+}
+
+// readParquet reads the rows of a file written by parquetPointsWriter
+// into maps of the column names to the values. The values that are not
+// set are left out.
+func readParquet(t *testing.T, data []byte) (schema []string, rows []map[string]interface{}) {
+	t.Helper()
+	n := len(data)
+	if string(data[:4]) != parquetMagic || string(data[n-4:]) != parquetMagic {
+		t.Fatalf("missing magic number")
+	}
+	size := int(binary.LittleEndian.Uint32(data[n-8:]))
+	footer := (&thriftDecoder{buf: data[n-8-size : n-8]}).structure()
+
+	elements := footer[2].([]interface{})
+	type column struct {
+		name     string
+		typ      int64
+		optional bool
+	}
+	var columns []column
+	for _, e := range elements[1:] {
+		e := e.(map[int64]interface{})
+		col := column{name: e[4].(string), typ: e[1].(int64), optional: e[3].(int64) == parquetOptional}
+		columns = append(columns, col)
+		schema = append(schema, fmt.Sprintf("%s:%d:%t", col.name, col.typ, col.optional))
+	}
+
+	for _, rg := range footer[4].([]interface{}) {
+		rg := rg.(map[int64]interface{})
+		numRows := int(rg[3].(int64))
+		start := len(rows)
+		for i := 0; i < numRows; i++ {
+			rows = append(rows, make(map[string]interface{}))
+		}
+		for i, chunk := range rg[1].([]interface{}) {
+			col := columns[i]
+			meta := chunk.(map[int64]interface{})[3].(map[int64]interface{})
+			d := &thriftDecoder{buf: data, pos: int(meta[9].(int64))}
+			header := d.structure()
+			page := data[d.pos : d.pos+int(header[3].(int64))]
+
+			defined := make([]bool, numRows)
+			for j := range defined {
+				defined[j] = true
+			}
+			if col.optional {
+				levels := &thriftDecoder{buf: page[4 : 4+binary.LittleEndian.Uint32(page)]}
+				for j := 0; levels.pos < len(levels.buf); {
+					run := int(levels.varint() >> 1)
+					set := levels.buf[levels.pos] == 1
+					levels.pos++
+					for ; run > 0; run-- {
+						defined[j] = set
+						j++
+					}
+				}
+				page = page[4+len(levels.buf):]
+			}
+
+			var bit int
+			for j := 0; j < numRows; j++ {
+				if !defined[j] {
+					continue
+				}
+				var v interface{}
+				switch col.typ {
+				case parquetInt64:
+					v = int64(binary.LittleEndian.Uint64(page))
+					page = page[8:]
+				case parquetDouble:
+					v = math.Float64frombits(binary.LittleEndian.Uint64(page))
+					page = page[8:]
+				case parquetBoolean:
+					v = page[bit/8]&(1<<uint(bit%8)) != 0
+					bit++
+				case parquetByteArray:
+					n := binary.LittleEndian.Uint32(page)
+					v = string(page[4 : 4+n])
+					page = page[4+n:]
+				}
+				rows[start+j][col.name] = v
+			}
+		}
+	}
+	return schema, rows
+}
+
+func TestParquetPointsWriter(t *testing.T) {
+	type point struct {
+		tags   map[string]string
+		fields map[string]interface{}
+	}
+	for _, tt := range []struct {
+		name   string
+		points []point
+		schema []string
+		rows   []map[string]interface{}
+	}{
+		{
+			name:   "NoPoints",
+			schema: []string{"time:2:false", "measurement:6:false"},
+		},
+		{
+			name: "TypedColumns",
+			points: []point{
+				{
+					tags:   map[string]string{"suite_name": "pkg", "test_name": "TestA"},
+					fields: map[string]interface{}{"duration": 0.5, "retries": int64(2), "failed": true, "message": "boom"},
+				},
+				{
+					tags:   map[string]string{"suite_name": "pkg"},
+					fields: map[string]interface{}{"duration": 1.25, "failed": false},
+				},
+			},
+			schema: []string{
+				"time:2:false", "measurement:6:false",
+				"suite_name:6:true", "test_name:6:true",
+				"duration:5:true", "failed:0:true", "message:6:true", "retries:2:true",
+			},
+			rows: []map[string]interface{}{
+				{"suite_name": "pkg", "test_name": "TestA", "duration": 0.5, "retries": int64(2), "failed": true, "message": "boom"},
+				{"suite_name": "pkg", "duration": 1.25, "failed": false},
+			},
+		},
+		{
+			name: "MixedNumbers",
+			points: []point{
+				{fields: map[string]interface{}{"value": int64(1)}},
+				{fields: map[string]interface{}{"value": 2.5}},
+			},
+			schema: []string{"time:2:false", "measurement:6:false", "value:5:true"},
+			rows: []map[string]interface{}{
+				{"value": 1.0},
+				{"value": 2.5},
+			},
+		},
+		{
+			name: "MixedTypes",
+			points: []point{
+				{fields: map[string]interface{}{"value": int64(1)}},
+				{fields: map[string]interface{}{"value": true}},
+			},
+			schema: []string{"time:2:false", "measurement:6:false", "value:6:true"},
+			rows: []map[string]interface{}{
+				{"value": "1"},
+				{"value": "true"},
+			},
+		},
+		{
+			name: "FieldNamedLikeTag",
+			points: []point{
+				{
+					tags:   map[string]string{"status": "ok"},
+					fields: map[string]interface{}{"status": int64(0), "time": int64(5)},
+				},
+			},
+			schema: []string{"time:2:false", "measurement:6:false", "status:6:true", "status_1:2:true", "time_1:2:true"},
+			rows: []map[string]interface{}{
+				{"status": "ok", "status_1": int64(0), "time_1": int64(5)},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf closeBuffer
+			pw := newParquetPointsWriter(&buf)
+			ts := time.Unix(1500000000, 123456000)
+			for _, p := range tt.points {
+				pt, err := influxdb.NewPoint("junit", p.tags, p.fields, ts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := pw.Write(pt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := pw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			schema, rows := readParquet(t, buf.Bytes())
+			if !reflect.DeepEqual(schema, tt.schema) {
+				t.Errorf("unexpected schema:\n got %v\nwant %v", schema, tt.schema)
+			}
+			if len(rows) != len(tt.rows) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.rows))
+			}
+			for i, row := range rows {
+				want := map[string]interface{}{"time": ts.UnixNano() / 1000, "measurement": "junit"}
+				for k, v := range tt.rows[i] {
+					want[k] = v
+				}
+				if !reflect.DeepEqual(row, want) {
+					t.Errorf("unexpected row %d:\n got %v\nwant %v", i, row, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParquetPointsWriterRowGroups(t *testing.T) {
+	var buf closeBuffer
+	pw := newParquetPointsWriter(&buf)
+	n := parquetRowGroupSize + 10
+	for i := 0; i < n; i++ {
+		pt, err := influxdb.NewPoint("junit", nil, map[string]interface{}{"n": int64(i)}, time.Unix(int64(i), 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Write(pt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rows := readParquet(t, buf.Bytes())
+	if len(rows) != n {
+		t.Fatalf("got %d rows, want %d", len(rows), n)
+	}
+	for i, row := range rows {
+		if row["n"] != int64(i) || row["time"] != int64(i)*1000000 {
+			t.Fatalf("unexpected row %d: %v", i, row)
+		}
+	}
+}
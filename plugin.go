@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// pluginPointsWriter streams points to an external writer plugin.
+//
+// A writer plugin is any executable. It is started once with the
+// INFLUX_JUNIT_FORMAT environment variable set to the format of the points
+// (line or jsonl) and the points are written to its stdin, one per line.
+// Line protocol timestamps are written with the configured precision.
+// Stdin is closed after the last point has been written and the plugin
+// should then finish writing the points to its backend and exit. A
+// non-zero exit status marks the write as failed. Anything the plugin
+// writes to stdout or stderr is passed through.
+type pluginPointsWriter struct {
+	cmd *exec.Cmd
+	pw  PointsWriter
+}
+
+func newPluginPointsWriter(path string, args []string, format, precision string) (*pluginPointsWriter, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(), "INFLUX_JUNIT_FORMAT="+format)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var pw PointsWriter
+	switch format {
+	case "line":
+		pw = &printPointsWriter{w: stdin, precision: precision}
+	case "jsonl":
+		pw = newJSONLPointsWriter(stdin)
+	default:
+		return nil, fmt.Errorf("unsupported writer plugin format: %s", format)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pluginPointsWriter{cmd: cmd, pw: pw}, nil
+}
+
+func (pw *pluginPointsWriter) Write(pt *influxdb.Point) error {
+	return pw.pw.Write(pt)
+}
+
+func (pw *pluginPointsWriter) Flush() error {
+	return pw.pw.Flush()
+}
+
+// Close closes the stdin of the plugin and waits for it to exit.
+func (pw *pluginPointsWriter) Close() error {
+	closeErr := pw.pw.(io.Closer).Close()
+	if err := pw.cmd.Wait(); err != nil {
+		return fmt.Errorf("writer plugin %s failed: %s", pw.cmd.Path, err)
+	}
+	return closeErr
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// sendStats counts the requests made by a writer that sends the points to
+// a server.
+type sendStats struct {
+	requests   int
+	bytes      int
+	retries    int
+	last       time.Duration
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+func (s *sendStats) add(bytes int, latency time.Duration) {
+	s.requests++
+	s.bytes += bytes
+	s.last = latency
+	s.latency += latency
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+}
+
+// statsWriter is implemented by the writers that may keep sendStats. The
+// stats are only valid when ok is true.
+type statsWriter interface {
+	sendStats() (stats sendStats, ok bool)
+}
+
+// writerStats returns the sendStats of a writer if it keeps them.
+func writerStats(pw PointsWriter) (sendStats, bool) {
+	if sw, ok := pw.(statsWriter); ok {
+		return sw.sendStats()
+	}
+	return sendStats{}, false
+}
+
+// progressReporter writes a line after each report and a summary of the
+// run at the end.
+type progressReporter struct {
+	w       io.Writer
+	c       *converter
+	pw      PointsWriter
+	total   int
+	done    int
+	failed  int
+	started time.Time
+}
+
+func newProgressReporter(w io.Writer, c *converter, pw PointsWriter, total int) *progressReporter {
+	return &progressReporter{w: w, c: c, pw: pw, total: total, started: time.Now()}
+}
+
+// report writes the progress after a report has been processed.
+func (p *progressReporter) report(path string, err error) {
+	p.done++
+	status := "ok"
+	if err != nil {
+		p.failed++
+		status = "failed"
+	}
+	line := fmt.Sprintf("[%d/%d] %s: %s, %d points", p.done, p.total, path, status, p.c.points)
+	if stats, ok := writerStats(p.pw); ok {
+		line += fmt.Sprintf(", %d bytes sent, %s write latency", stats.bytes, stats.last)
+	}
+	fmt.Fprintln(p.w, line)
+}
+
+// summary writes a table with the totals of the run.
+func (p *progressReporter) summary() error {
+	tw := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "reports\tfailed\tpoints\tbytes\trequests\tavg latency\tmax latency\telapsed")
+	bytes, requests, avg, max := "-", "-", "-", "-"
+	if stats, ok := writerStats(p.pw); ok {
+		bytes = fmt.Sprint(stats.bytes)
+		requests = fmt.Sprint(stats.requests)
+		if stats.requests > 0 {
+			avg = fmt.Sprint(stats.latency / time.Duration(stats.requests))
+			max = fmt.Sprint(stats.maxLatency)
+		}
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", p.done, p.failed, p.c.points, bytes, requests, avg, max, time.Since(p.started))
+	return tw.Flush()
+}
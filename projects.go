@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// projectConfig holds the settings of a project for the serve command. The
+// projects are read from a yaml file such as
+//
+//	frontend:
+//	  token: 4f3c2a...
+//	  database: web
+//	  tags:
+//	    team: web
+//	backend:
+//	  token: 9b1d7e...
+//	  database: services
+//	  retention-policy: short
+type projectConfig struct {
+	// token is the bearer token that must be used to upload the reports
+	// of the project.
+	token string
+
+	// database and retentionPolicy replace the --database and
+	// --retention-policy options for the project when they are set.
+	database        string
+	retentionPolicy string
+
+	// tags are added to the points of the project.
+	tags map[string]string
+}
+
+// readProjects reads the project settings from a yaml file.
+func readProjects(path string) (map[string]*projectConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseProjects(v)
+}
+
+func parseProjects(v interface{}) (map[string]*projectConfig, error) {
+	m, err := yamlMap(v)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(map[string]*projectConfig, len(m))
+	for name, value := range m {
+		pm, err := yamlMap(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		var p projectConfig
+		for key, value := range pm {
+			switch key {
+			case "token":
+				if p.token, err = yamlString(value); err != nil {
+					return nil, fmt.Errorf("%s: token: %s", name, err)
+				}
+			case "database":
+				if p.database, err = yamlString(value); err != nil {
+					return nil, fmt.Errorf("%s: database: %s", name, err)
+				}
+			case "retention-policy":
+				if p.retentionPolicy, err = yamlString(value); err != nil {
+					return nil, fmt.Errorf("%s: retention-policy: %s", name, err)
+				}
+			case "tags":
+				tags, err := yamlMap(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: tags: %s", name, err)
+				}
+				p.tags = make(map[string]string, len(tags))
+				for k, v := range tags {
+					if p.tags[k], err = yamlString(v); err != nil {
+						return nil, fmt.Errorf("%s: tags: %s: %s", name, k, err)
+					}
+				}
+			default:
+				return nil, fmt.Errorf("%s: unknown key %q", name, key)
+			}
+		}
+		projects[name] = &p
+	}
+	return projects, nil
+}
+
+// connection returns a copy of conn that writes to the database and
+// retention policy of the project.
+func (p *projectConfig) connection(conn *connectionOptions) *connectionOptions {
+	c := *conn
+	if p.database != "" {
+		c.database = p.database
+	}
+	if p.retentionPolicy != "" {
+		c.retentionPolicy = p.retentionPolicy
+	}
+	return &c
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProjects(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    string
+		want    map[string]*projectConfig
+		wantErr bool
+	}{
+		{
+			name: "Projects",
+			data: "api:\n  token: secret\n  database: api_tests\n  retention-policy: weekly\n  tags:\n    team: core\n    tier: 1\nweb:\n",
+			want: map[string]*projectConfig{
+				"api": {
+					token:           "secret",
+					database:        "api_tests",
+					retentionPolicy: "weekly",
+					tags:            map[string]string{"team": "core", "tier": "1"},
+				},
+				"web": {},
+			},
+		},
+		{
+			name:    "UnknownKey",
+			data:    "api:\n  bucket: api\n",
+			wantErr: true,
+		},
+		{
+			name:    "ProjectNotMapping",
+			data:    "api: secret\n",
+			wantErr: true,
+		},
+		{
+			name:    "TagNotString",
+			data:    "api:\n  tags:\n    team: [core]\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseYAML([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseProjects(v)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected projects:\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
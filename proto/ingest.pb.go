@@ -0,0 +1,508 @@
+// The ingestion API of influx-junit serve. It mirrors the /ingest http
+// endpoint: the reports of a project are converted with the options of the
+// server and written to the database of the project.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: proto/ingest.proto
+
+package ingestpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TestResult_Status int32
+
+const (
+	TestResult_STATUS_UNSPECIFIED TestResult_Status = 0
+	TestResult_STATUS_PASSED      TestResult_Status = 1
+	TestResult_STATUS_FAILED      TestResult_Status = 2
+	TestResult_STATUS_ERROR       TestResult_Status = 3
+	TestResult_STATUS_SKIPPED     TestResult_Status = 4
+)
+
+// Enum value maps for TestResult_Status.
+var (
+	TestResult_Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "STATUS_PASSED",
+		2: "STATUS_FAILED",
+		3: "STATUS_ERROR",
+		4: "STATUS_SKIPPED",
+	}
+	TestResult_Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED": 0,
+		"STATUS_PASSED":      1,
+		"STATUS_FAILED":      2,
+		"STATUS_ERROR":       3,
+		"STATUS_SKIPPED":     4,
+	}
+)
+
+func (x TestResult_Status) Enum() *TestResult_Status {
+	p := new(TestResult_Status)
+	*p = x
+	return p
+}
+
+func (x TestResult_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TestResult_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_ingest_proto_enumTypes[0].Descriptor()
+}
+
+func (TestResult_Status) Type() protoreflect.EnumType {
+	return &file_proto_ingest_proto_enumTypes[0]
+}
+
+func (x TestResult_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TestResult_Status.Descriptor instead.
+func (TestResult_Status) EnumDescriptor() ([]byte, []int) {
+	return file_proto_ingest_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type SubmitReportsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// project is added to every point as the project tag. It may be left
+	// out when the call is authenticated with a project token.
+	Project       string    `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	Reports       []*Report `protobuf:"bytes,2,rep,name=reports,proto3" json:"reports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitReportsRequest) Reset() {
+	*x = SubmitReportsRequest{}
+	mi := &file_proto_ingest_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitReportsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitReportsRequest) ProtoMessage() {}
+
+func (x *SubmitReportsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_ingest_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitReportsRequest.ProtoReflect.Descriptor instead.
+func (*SubmitReportsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_ingest_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitReportsRequest) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *SubmitReportsRequest) GetReports() []*Report {
+	if x != nil {
+		return x.Reports
+	}
+	return nil
+}
+
+// Report is a junit xml report, which may be gzip compressed.
+type Report struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// project is only read from the first report of a stream.
+	Project       string `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	Name          string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Content       []byte `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Report) Reset() {
+	*x = Report{}
+	mi := &file_proto_ingest_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Report) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Report) ProtoMessage() {}
+
+func (x *Report) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_ingest_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Report.ProtoReflect.Descriptor instead.
+func (*Report) Descriptor() ([]byte, []int) {
+	return file_proto_ingest_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Report) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *Report) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Report) GetContent() []byte {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+type TestResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// project is only read from the first result of a stream.
+	Project         string            `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	SuiteName       string            `protobuf:"bytes,2,opt,name=suite_name,json=suiteName,proto3" json:"suite_name,omitempty"`
+	ClassName       string            `protobuf:"bytes,3,opt,name=class_name,json=className,proto3" json:"class_name,omitempty"`
+	TestName        string            `protobuf:"bytes,4,opt,name=test_name,json=testName,proto3" json:"test_name,omitempty"`
+	Status          TestResult_Status `protobuf:"varint,5,opt,name=status,proto3,enum=influxjunit.v1.TestResult_Status" json:"status,omitempty"`
+	DurationSeconds float64           `protobuf:"fixed64,6,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	FailureMessage  string            `protobuf:"bytes,7,opt,name=failure_message,json=failureMessage,proto3" json:"failure_message,omitempty"`
+	FailureType     string            `protobuf:"bytes,8,opt,name=failure_type,json=failureType,proto3" json:"failure_type,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *TestResult) Reset() {
+	*x = TestResult{}
+	mi := &file_proto_ingest_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TestResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestResult) ProtoMessage() {}
+
+func (x *TestResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_ingest_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestResult.ProtoReflect.Descriptor instead.
+func (*TestResult) Descriptor() ([]byte, []int) {
+	return file_proto_ingest_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TestResult) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *TestResult) GetSuiteName() string {
+	if x != nil {
+		return x.SuiteName
+	}
+	return ""
+}
+
+func (x *TestResult) GetClassName() string {
+	if x != nil {
+		return x.ClassName
+	}
+	return ""
+}
+
+func (x *TestResult) GetTestName() string {
+	if x != nil {
+		return x.TestName
+	}
+	return ""
+}
+
+func (x *TestResult) GetStatus() TestResult_Status {
+	if x != nil {
+		return x.Status
+	}
+	return TestResult_STATUS_UNSPECIFIED
+}
+
+func (x *TestResult) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *TestResult) GetFailureMessage() string {
+	if x != nil {
+		return x.FailureMessage
+	}
+	return ""
+}
+
+func (x *TestResult) GetFailureType() string {
+	if x != nil {
+		return x.FailureType
+	}
+	return ""
+}
+
+// IngestResult has the same fields as the response of the /ingest
+// endpoint.
+type IngestResult struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Project  string                 `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	Reports  int64                  `protobuf:"varint,2,opt,name=reports,proto3" json:"reports,omitempty"`
+	Tests    int64                  `protobuf:"varint,3,opt,name=tests,proto3" json:"tests,omitempty"`
+	Failures int64                  `protobuf:"varint,4,opt,name=failures,proto3" json:"failures,omitempty"`
+	Errors   int64                  `protobuf:"varint,5,opt,name=errors,proto3" json:"errors,omitempty"`
+	Skipped  int64                  `protobuf:"varint,6,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	Points   int64                  `protobuf:"varint,7,opt,name=points,proto3" json:"points,omitempty"`
+	// queued is set when the points were stored in the write-ahead log to
+	// be written later.
+	Queued        bool `protobuf:"varint,8,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResult) Reset() {
+	*x = IngestResult{}
+	mi := &file_proto_ingest_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResult) ProtoMessage() {}
+
+func (x *IngestResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_ingest_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResult.ProtoReflect.Descriptor instead.
+func (*IngestResult) Descriptor() ([]byte, []int) {
+	return file_proto_ingest_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IngestResult) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *IngestResult) GetReports() int64 {
+	if x != nil {
+		return x.Reports
+	}
+	return 0
+}
+
+func (x *IngestResult) GetTests() int64 {
+	if x != nil {
+		return x.Tests
+	}
+	return 0
+}
+
+func (x *IngestResult) GetFailures() int64 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *IngestResult) GetErrors() int64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *IngestResult) GetSkipped() int64 {
+	if x != nil {
+		return x.Skipped
+	}
+	return 0
+}
+
+func (x *IngestResult) GetPoints() int64 {
+	if x != nil {
+		return x.Points
+	}
+	return 0
+}
+
+func (x *IngestResult) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+var File_proto_ingest_proto protoreflect.FileDescriptor
+
+const file_proto_ingest_proto_rawDesc = "" +
+	"\n" +
+	"\x12proto/ingest.proto\x12\x0einfluxjunit.v1\"b\n" +
+	"\x14SubmitReportsRequest\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x120\n" +
+	"\areports\x18\x02 \x03(\v2\x16.influxjunit.v1.ReportR\areports\"P\n" +
+	"\x06Report\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\fR\acontent\"\xa1\x03\n" +
+	"\n" +
+	"TestResult\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x1d\n" +
+	"\n" +
+	"suite_name\x18\x02 \x01(\tR\tsuiteName\x12\x1d\n" +
+	"\n" +
+	"class_name\x18\x03 \x01(\tR\tclassName\x12\x1b\n" +
+	"\ttest_name\x18\x04 \x01(\tR\btestName\x129\n" +
+	"\x06status\x18\x05 \x01(\x0e2!.influxjunit.v1.TestResult.StatusR\x06status\x12)\n" +
+	"\x10duration_seconds\x18\x06 \x01(\x01R\x0fdurationSeconds\x12'\n" +
+	"\x0ffailure_message\x18\a \x01(\tR\x0efailureMessage\x12!\n" +
+	"\ffailure_type\x18\b \x01(\tR\vfailureType\"l\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rSTATUS_PASSED\x10\x01\x12\x11\n" +
+	"\rSTATUS_FAILED\x10\x02\x12\x10\n" +
+	"\fSTATUS_ERROR\x10\x03\x12\x12\n" +
+	"\x0eSTATUS_SKIPPED\x10\x04\"\xd6\x01\n" +
+	"\fIngestResult\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x18\n" +
+	"\areports\x18\x02 \x01(\x03R\areports\x12\x14\n" +
+	"\x05tests\x18\x03 \x01(\x03R\x05tests\x12\x1a\n" +
+	"\bfailures\x18\x04 \x01(\x03R\bfailures\x12\x16\n" +
+	"\x06errors\x18\x05 \x01(\x03R\x06errors\x12\x18\n" +
+	"\askipped\x18\x06 \x01(\x03R\askipped\x12\x16\n" +
+	"\x06points\x18\a \x01(\x03R\x06points\x12\x16\n" +
+	"\x06queued\x18\b \x01(\bR\x06queued2\xf7\x01\n" +
+	"\x06Ingest\x12S\n" +
+	"\rSubmitReports\x12$.influxjunit.v1.SubmitReportsRequest\x1a\x1c.influxjunit.v1.IngestResult\x12G\n" +
+	"\rStreamReports\x12\x16.influxjunit.v1.Report\x1a\x1c.influxjunit.v1.IngestResult(\x01\x12O\n" +
+	"\x11StreamTestResults\x12\x1a.influxjunit.v1.TestResult\x1a\x1c.influxjunit.v1.IngestResult(\x01B3Z1github.com/jsternberg/influx-junit/proto;ingestpbb\x06proto3"
+
+var (
+	file_proto_ingest_proto_rawDescOnce sync.Once
+	file_proto_ingest_proto_rawDescData []byte
+)
+
+func file_proto_ingest_proto_rawDescGZIP() []byte {
+	file_proto_ingest_proto_rawDescOnce.Do(func() {
+		file_proto_ingest_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_ingest_proto_rawDesc), len(file_proto_ingest_proto_rawDesc)))
+	})
+	return file_proto_ingest_proto_rawDescData
+}
+
+var file_proto_ingest_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_ingest_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_ingest_proto_goTypes = []any{
+	(TestResult_Status)(0),       // 0: influxjunit.v1.TestResult.Status
+	(*SubmitReportsRequest)(nil), // 1: influxjunit.v1.SubmitReportsRequest
+	(*Report)(nil),               // 2: influxjunit.v1.Report
+	(*TestResult)(nil),           // 3: influxjunit.v1.TestResult
+	(*IngestResult)(nil),         // 4: influxjunit.v1.IngestResult
+}
+var file_proto_ingest_proto_depIdxs = []int32{
+	2, // 0: influxjunit.v1.SubmitReportsRequest.reports:type_name -> influxjunit.v1.Report
+	0, // 1: influxjunit.v1.TestResult.status:type_name -> influxjunit.v1.TestResult.Status
+	1, // 2: influxjunit.v1.Ingest.SubmitReports:input_type -> influxjunit.v1.SubmitReportsRequest
+	2, // 3: influxjunit.v1.Ingest.StreamReports:input_type -> influxjunit.v1.Report
+	3, // 4: influxjunit.v1.Ingest.StreamTestResults:input_type -> influxjunit.v1.TestResult
+	4, // 5: influxjunit.v1.Ingest.SubmitReports:output_type -> influxjunit.v1.IngestResult
+	4, // 6: influxjunit.v1.Ingest.StreamReports:output_type -> influxjunit.v1.IngestResult
+	4, // 7: influxjunit.v1.Ingest.StreamTestResults:output_type -> influxjunit.v1.IngestResult
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_ingest_proto_init() }
+func file_proto_ingest_proto_init() {
+	if File_proto_ingest_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_ingest_proto_rawDesc), len(file_proto_ingest_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_ingest_proto_goTypes,
+		DependencyIndexes: file_proto_ingest_proto_depIdxs,
+		EnumInfos:         file_proto_ingest_proto_enumTypes,
+		MessageInfos:      file_proto_ingest_proto_msgTypes,
+	}.Build()
+	File_proto_ingest_proto = out.File
+	file_proto_ingest_proto_goTypes = nil
+	file_proto_ingest_proto_depIdxs = nil
+}
@@ -0,0 +1,202 @@
+// The ingestion API of influx-junit serve. It mirrors the /ingest http
+// endpoint: the reports of a project are converted with the options of the
+// server and written to the database of the project.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: proto/ingest.proto
+
+package ingestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ingest_SubmitReports_FullMethodName     = "/influxjunit.v1.Ingest/SubmitReports"
+	Ingest_StreamReports_FullMethodName     = "/influxjunit.v1.Ingest/StreamReports"
+	Ingest_StreamTestResults_FullMethodName = "/influxjunit.v1.Ingest/StreamTestResults"
+)
+
+// IngestClient is the client API for Ingest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IngestClient interface {
+	// SubmitReports converts and writes the reports of an upload. The points
+	// are only written if every report can be converted.
+	SubmitReports(ctx context.Context, in *SubmitReportsRequest, opts ...grpc.CallOption) (*IngestResult, error)
+	// StreamReports writes each report as it is received and returns the
+	// totals once the client closes the stream.
+	StreamReports(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Report, IngestResult], error)
+	// StreamTestResults writes the results of tests that were already
+	// parsed, such as the events of a running test command, as they are
+	// received.
+	StreamTestResults(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TestResult, IngestResult], error)
+}
+
+type ingestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestClient(cc grpc.ClientConnInterface) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) SubmitReports(ctx context.Context, in *SubmitReportsRequest, opts ...grpc.CallOption) (*IngestResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IngestResult)
+	err := c.cc.Invoke(ctx, Ingest_SubmitReports_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestClient) StreamReports(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Report, IngestResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[0], Ingest_StreamReports_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Report, IngestResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_StreamReportsClient = grpc.ClientStreamingClient[Report, IngestResult]
+
+func (c *ingestClient) StreamTestResults(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[TestResult, IngestResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[1], Ingest_StreamTestResults_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TestResult, IngestResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_StreamTestResultsClient = grpc.ClientStreamingClient[TestResult, IngestResult]
+
+// IngestServer is the server API for Ingest service.
+// All implementations must embed UnimplementedIngestServer
+// for forward compatibility.
+type IngestServer interface {
+	// SubmitReports converts and writes the reports of an upload. The points
+	// are only written if every report can be converted.
+	SubmitReports(context.Context, *SubmitReportsRequest) (*IngestResult, error)
+	// StreamReports writes each report as it is received and returns the
+	// totals once the client closes the stream.
+	StreamReports(grpc.ClientStreamingServer[Report, IngestResult]) error
+	// StreamTestResults writes the results of tests that were already
+	// parsed, such as the events of a running test command, as they are
+	// received.
+	StreamTestResults(grpc.ClientStreamingServer[TestResult, IngestResult]) error
+	mustEmbedUnimplementedIngestServer()
+}
+
+// UnimplementedIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIngestServer struct{}
+
+func (UnimplementedIngestServer) SubmitReports(context.Context, *SubmitReportsRequest) (*IngestResult, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitReports not implemented")
+}
+func (UnimplementedIngestServer) StreamReports(grpc.ClientStreamingServer[Report, IngestResult]) error {
+	return status.Error(codes.Unimplemented, "method StreamReports not implemented")
+}
+func (UnimplementedIngestServer) StreamTestResults(grpc.ClientStreamingServer[TestResult, IngestResult]) error {
+	return status.Error(codes.Unimplemented, "method StreamTestResults not implemented")
+}
+func (UnimplementedIngestServer) mustEmbedUnimplementedIngestServer() {}
+func (UnimplementedIngestServer) testEmbeddedByValue()                {}
+
+// UnsafeIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServer will
+// result in compilation errors.
+type UnsafeIngestServer interface {
+	mustEmbedUnimplementedIngestServer()
+}
+
+func RegisterIngestServer(s grpc.ServiceRegistrar, srv IngestServer) {
+	// If the following call panics, it indicates UnimplementedIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ingest_ServiceDesc, srv)
+}
+
+func _Ingest_SubmitReports_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitReportsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServer).SubmitReports(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ingest_SubmitReports_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServer).SubmitReports(ctx, req.(*SubmitReportsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ingest_StreamReports_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).StreamReports(&grpc.GenericServerStream[Report, IngestResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_StreamReportsServer = grpc.ClientStreamingServer[Report, IngestResult]
+
+func _Ingest_StreamTestResults_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).StreamTestResults(&grpc.GenericServerStream[TestResult, IngestResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_StreamTestResultsServer = grpc.ClientStreamingServer[TestResult, IngestResult]
+
+// Ingest_ServiceDesc is the grpc.ServiceDesc for Ingest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ingest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "influxjunit.v1.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitReports",
+			Handler:    _Ingest_SubmitReports_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamReports",
+			Handler:       _Ingest_StreamReports_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamTestResults",
+			Handler:       _Ingest_StreamTestResults_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/ingest.proto",
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// quarantineOptions are the options of the quarantine report.
+type quarantineOptions struct {
+	*flakyOptions
+	minScore   float64
+	listFormat string
+}
+
+func addQuarantineFlags(fs *pflag.FlagSet) *quarantineOptions {
+	o := &quarantineOptions{flakyOptions: addFlakyFlags(fs, 0)}
+	fs.Float64Var(&o.minScore, "min-score", 0.1, "only quarantine the testcases with at least this flakiness score unless they passed and failed on the same commit")
+	fs.StringVar(&o.listFormat, "list-format", "list", "format of the quarantine list (list, go, pytest)")
+	return o
+}
+
+// reportQuarantine writes the flaky testcases in a form that a test runner
+// can use to skip them. The list format has a test name on each line. The
+// go format is a regular expression for go test -skip that matches the top
+// level tests, so a flaky subtest quarantines its parent. The pytest format
+// is a conftest.py plugin that marks the tests with the same name as xfail.
+func reportQuarantine(args []string) {
+	fs := pflag.NewFlagSet("report quarantine", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "report quarantine [options]")
+	o := addQuarantineFlags(fs)
+	fs.Parse(args)
+	o.validate(fs)
+
+	var write func(w io.Writer, names []string) error
+	switch o.listFormat {
+	case "list":
+		write = writeQuarantineList
+	case "go":
+		write = writeQuarantineGo
+	case "pytest":
+		write = writeQuarantinePytest
+	default:
+		logger.Exitf(exitUsage, "Invalid --list-format value: %s", o.listFormat)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range queryFlakyTests(o.flakyOptions) {
+		if t.flakyCommits() == 0 && t.score() < o.minScore {
+			continue
+		}
+		if !seen[t.name] {
+			seen[t.name] = true
+			names = append(names, t.name)
+		}
+	}
+	sort.Strings(names)
+	logger.Info("Quarantined testcases", "count", len(names))
+	o.writeOutput(func(w io.Writer) error {
+		return write(w, names)
+	})
+}
+
+func writeQuarantineList(w io.Writer, names []string) error {
+	for _, name := range names {
+		if _, err := fmt.Fprintln(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQuarantineGo writes a pattern for go test -skip. It matches nothing
+// when there are no names so the flag can always be passed.
+func writeQuarantineGo(w io.Writer, names []string) error {
+	var tests []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		if !seen[name] {
+			seen[name] = true
+			tests = append(tests, regexp.QuoteMeta(name))
+		}
+	}
+	if len(tests) == 0 {
+		_, err := fmt.Fprintln(w, "^$")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "^(%s)$\n", strings.Join(tests, "|"))
+	return err
+}
+
+func writeQuarantinePytest(w io.Writer, names []string) error {
+	var buf strings.Builder
+	buf.WriteString("# Generated by influx-junit report quarantine.\nimport pytest\n\nQUARANTINED = {\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "    %s,\n", pythonString(name))
+	}
+	buf.WriteString(`}
+
+
+def pytest_collection_modifyitems(items):
+    for item in items:
+        if item.name in QUARANTINED:
+            item.add_marker(pytest.mark.xfail(reason="quarantined as flaky", strict=False))
+`)
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// pythonString quotes a string literal for python.
+func pythonString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\x%02x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// queryDurationBaseline reads the median duration in seconds of every
+// testcase on the branch within the window, such as 14d. The measurement is
+// read from the retention policy the points are written to. The testcases
+// are identified by their suite and name since the classname is not always
+// a tag.
+func queryDurationBaseline(client influxdb.Client, database, retentionPolicy, measurement, branch, window string, durationScale float64) (map[testKey]float64, error) {
+	baseline := make(map[testKey]float64)
+	stmt := fmt.Sprintf(`SELECT median("duration") FROM %s WHERE "branch" = %s AND time > now() - %s GROUP BY "suite_name", "test_name"`, qualifiedMeasurement(database, retentionPolicy, measurement), quoteString(branch), window)
+	err := queryRows(client, database, stmt, func(tags map[string]string, values map[string]interface{}) {
+		if n, ok := jsonFloat(values["median"]); ok {
+			if durationScale != 0 {
+				n /= durationScale
+			}
+			baseline[testKey{Suite: tags["suite_name"], Name: tags["test_name"]}] = n
+		}
+	})
+	return baseline, err
+}
+
+// writeRegressions writes a point for each testcase of the run that took at
+// least factor times its baseline duration and logs a warning for it. The
+// testcases without a baseline are new on the branch and are left out.
+func (c *converter) writeRegressions(pw PointsWriter, measurement, branch string, baseline map[testKey]float64, factor float64, now time.Time) error {
+	var slower []testDuration
+	for _, d := range c.run.durations {
+		base := baseline[testKey{Suite: d.key.Suite, Name: d.key.Name}]
+		if base > 0 && d.seconds >= base*factor {
+			slower = append(slower, d)
+		}
+	}
+	sort.SliceStable(slower, func(i, j int) bool {
+		bi := baseline[testKey{Suite: slower[i].key.Suite, Name: slower[i].key.Name}]
+		bj := baseline[testKey{Suite: slower[j].key.Suite, Name: slower[j].key.Name}]
+		return slower[i].seconds/bi > slower[j].seconds/bj
+	})
+
+	for _, d := range slower {
+		base := baseline[testKey{Suite: d.key.Suite, Name: d.key.Name}]
+		logger.Warnf("%s %s took %.3fs, %.1fx the median of %.3fs on %s", d.key.Suite, d.key.Name, d.seconds, d.seconds/base, base, branch)
+		tags := map[string]string{
+			"suite_name":      d.key.Suite,
+			"test_name":       d.key.Name,
+			"baseline_branch": branch,
+		}
+		fields := map[string]interface{}{
+			"duration":          c.duration(d.seconds),
+			"baseline_duration": c.duration(base),
+			"factor":            d.seconds / base,
+		}
+		if err := c.writePoint(pw, measurement, newTemplateData(nil, nil), tags, fields, now); err != nil {
+			return err
+		}
+	}
+	c.run.regressions += len(slower)
+	return nil
+}
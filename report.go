@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+	"github.com/spf13/pflag"
+)
+
+// reportCommand is a subcommand of the report command.
+type reportCommand struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var reportCommands []reportCommand
+
+func init() {
+	reportCommands = []reportCommand{
+		{name: "flaky", summary: "rank the testcases that pass and fail on the same code", run: reportFlaky},
+		{name: "slowest", summary: "list the slowest testcases and whether they are getting slower", run: reportSlowest},
+		{name: "quarantine", summary: "write the flaky testcases as a skip list for go, pytest, or other tools", run: reportQuarantine},
+		{name: "trend", summary: "show the pass rate and duration over time", run: reportTrend},
+	}
+}
+
+// report runs the report named by the first argument.
+func report(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		reportUsage()
+		if len(args) == 0 {
+			exit(exitUsage)
+		}
+		return
+	}
+	for _, cmd := range reportCommands {
+		if cmd.name == args[0] {
+			cmd.run(args[1:])
+			return
+		}
+	}
+	logger.Exitf(exitUsage, "Unknown report: %s", args[0])
+}
+
+func reportUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: influx-junit report <report> [options]\n\nReports:\n")
+	for _, cmd := range reportCommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"influx-junit report <report> --help\" for the options of a report.\n")
+}
+
+// reportOptions are the options shared by the reports that query the
+// results stored in influxdb.
+type reportOptions struct {
+	conn        *connectionOptions
+	log         *logOptions
+	measurement string
+	since       string
+	branch      string
+	format      string
+	output      string
+
+	durationUnit  string
+	durationScale float64
+}
+
+func addReportFlags(fs *pflag.FlagSet) *reportOptions {
+	o := &reportOptions{conn: addQueryFlags(fs), log: addLogFlags(fs)}
+	fs.StringVarP(&o.measurement, "measurement", "m", "junit_test_results", "measurement of the testcase points")
+	fs.StringVar(&o.since, "since", "14d", "how far back to read the results, such as 12h, 30d, or 4w")
+	fs.StringVar(&o.branch, "branch", "", "only read the results of this branch")
+	fs.StringVar(&o.format, "format", "text", "output format (text, csv, json)")
+	fs.StringVarP(&o.output, "output", "o", "", "write the report to this file instead of stdout")
+	fs.StringVar(&o.durationUnit, "duration-unit", "s", "unit of the duration fields in influxdb (s, ms, us)")
+	return o
+}
+
+var influxDurationRE = regexp.MustCompile(`^[0-9]+(s|m|h|d|w)$`)
+
+// validate applies the environment to the options and validates them.
+func (o *reportOptions) validate(fs *pflag.FlagSet) {
+	if err := applyEnv(fs); err != nil {
+		logger.Exitf(exitUsage, "Invalid environment variable %s", err)
+	}
+	if err := o.log.configure(); err != nil {
+		logger.Exitf(exitUsage, "%s", err)
+	}
+	if !influxDurationRE.MatchString(o.since) {
+		logger.Exitf(exitUsage, "Invalid --since value: %s", o.since)
+	}
+	switch o.format {
+	case "text", "csv", "json":
+	default:
+		logger.Exitf(exitUsage, "Invalid --format value: %s", o.format)
+	}
+	scale, ok := map[string]float64{"s": 1, "ms": 1e3, "us": 1e6}[o.durationUnit]
+	if !ok {
+		logger.Exitf(exitUsage, "Invalid --duration-unit value: %s", o.durationUnit)
+	}
+	o.durationScale = scale
+}
+
+// connect returns the client for the queries of the report.
+func (o *reportOptions) connect() influxdb.Client {
+	if o.conn.database == "" {
+		logger.Exitf(exitUsage, "Must specify a database")
+	}
+	client, err := o.conn.newClient()
+	if err != nil {
+		logger.Exitf(exitUsage, "Could not create HTTP client: %s", err)
+	}
+	return client
+}
+
+// source returns the measurement to select from, qualified with the
+// retention policy when there is one.
+func (o *reportOptions) source() string {
+	if o.conn.retentionPolicy != "" {
+		return quoteIdent(o.conn.retentionPolicy) + "." + quoteIdent(o.measurement)
+	}
+	return quoteIdent(o.measurement)
+}
+
+// where returns the condition selecting the results within the window of
+// the report.
+func (o *reportOptions) where() string {
+	cond := "time > now() - " + o.since
+	if o.branch != "" {
+		cond += ` AND "branch" = ` + quoteString(o.branch)
+	}
+	return cond
+}
+
+// writeTable writes the table to the output of the report.
+func (o *reportOptions) writeTable(t *reportTable) {
+	o.writeOutput(func(w io.Writer) error {
+		return t.write(w, o.format)
+	})
+}
+
+// writeOutput calls fn with the output of the report, which is stdout
+// unless --output is used.
+func (o *reportOptions) writeOutput(fn func(w io.Writer) error) {
+	w := io.Writer(os.Stdout)
+	if o.output != "" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			logger.Fatalf("Unable to create output: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := fn(w); err != nil {
+		logger.Fatalf("Could not write the report: %s", err)
+	}
+}
+
+// seconds returns a duration read from influxdb in seconds.
+func (o *reportOptions) seconds(v interface{}) (float64, bool) {
+	n, ok := jsonFloat(v)
+	return n / o.durationScale, ok
+}
+
+// queryRows runs the query and calls fn with the tags and the values of
+// each row by column name.
+func queryRows(client influxdb.Client, database, stmt string, fn func(tags map[string]string, values map[string]interface{})) error {
+	logger.Debug("Running query", "query", stmt)
+	resp, err := client.Query(influxdb.NewQuery(stmt, database, ""))
+	if err != nil {
+		return err
+	} else if err := resp.Error(); err != nil {
+		return err
+	}
+	for _, result := range resp.Results {
+		for _, row := range result.Series {
+			for _, values := range row.Values {
+				m := make(map[string]interface{}, len(values))
+				for i, v := range values {
+					if i < len(row.Columns) {
+						m[row.Columns[i]] = v
+					}
+				}
+				fn(row.Tags, m)
+			}
+		}
+	}
+	return nil
+}
+
+// reportTable holds the rows of a report.
+type reportTable struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (t *reportTable) add(values ...interface{}) {
+	t.rows = append(t.rows, values)
+}
+
+// write writes the table aligned in columns as text, as csv with a header,
+// or as a json array with an object per row.
+func (t *reportTable) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		objects := make([]map[string]interface{}, 0, len(t.rows))
+		for _, row := range t.rows {
+			obj := make(map[string]interface{}, len(row))
+			for i, v := range row {
+				obj[t.columns[i]] = v
+			}
+			objects = append(objects, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objects)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(t.columns)
+		for _, row := range t.rows {
+			record := make([]string, len(row))
+			for i, v := range row {
+				record[i] = formatReportValue(v)
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.columns, "\t")))
+		for _, row := range t.rows {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				// Whitespace within a name would break the columns.
+				cells[i] = strings.Join(strings.Fields(formatReportValue(v)), " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+func formatReportValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%.4g", v)
+	}
+	return fmt.Sprint(v)
+}
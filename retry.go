@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy retries a write that failed with a server error or a network
+// error with a jittered exponential backoff.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// do calls fn until it succeeds, fails with an error that should not be
+// retried, or the retries are used up.
+func (p retryPolicy) do(fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.retries || !retryable(err) {
+			return err
+		}
+		delay := p.delay(attempt, err)
+		logger.Warnf("Could not write points, retrying in %s (%d of %d): %s", delay, attempt+1, p.retries, err)
+		time.Sleep(delay)
+	}
+}
+
+// delay returns how long to wait before the retry after the attempt. The
+// Retry-After header of the response is used when the server sent one.
+func (p retryPolicy) delay(attempt int, err error) time.Duration {
+	if e, ok := err.(*httpError); ok && e.retryAfter > 0 {
+		return e.retryAfter
+	}
+	d := p.backoff << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+	// Wait between half and all of the backoff so clients that failed
+	// at the same time do not retry at the same time.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// httpError is returned when the server responds to a write with an error.
+type httpError struct {
+	status     int
+	retryAfter time.Duration
+	msg        string
+}
+
+func (e *httpError) Error() string {
+	if e.msg == "" {
+		return http.StatusText(e.status)
+	}
+	return e.msg
+}
+
+// retryable reports whether a write that failed with err may succeed when
+// it is sent again. Errors without a response, such as timeouts or refused
+// connections, are retried along with server errors and rate limits.
+func retryable(err error) bool {
+	if e, ok := err.(*httpError); ok {
+		return e.status >= 500 || e.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or a date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
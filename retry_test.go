@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{v: "", want: 0},
+		{v: "30", want: 30 * time.Second},
+		{v: "-5", want: 0},
+		{v: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{v: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{v: "soon", want: 0},
+	} {
+		t.Run(tt.v, func(t *testing.T) {
+			if got := parseRetryAfter(tt.v, now); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "ConnectionError", err: errors.New("connection refused"), want: true},
+		{name: "ServerError", err: &httpError{status: http.StatusInternalServerError}, want: true},
+		{name: "TooManyRequests", err: &httpError{status: http.StatusTooManyRequests}, want: true},
+		{name: "BadRequest", err: &httpError{status: http.StatusBadRequest}, want: false},
+		{name: "NotFound", err: &httpError{status: http.StatusNotFound}, want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
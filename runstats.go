@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// countingPointsWriter counts the points and series written to another
+// writer for each measurement. Points only count once they are flushed
+// without an error.
+type countingPointsWriter struct {
+	pw           PointsWriter
+	pending      []measurementSeries
+	measurements map[string]*measurementCount
+}
+
+type measurementSeries struct {
+	name, key string
+}
+
+type measurementCount struct {
+	points int
+	series map[string]bool
+}
+
+func newCountingPointsWriter(pw PointsWriter) *countingPointsWriter {
+	return &countingPointsWriter{pw: pw, measurements: make(map[string]*measurementCount)}
+}
+
+func (pw *countingPointsWriter) Write(pt *influxdb.Point) error {
+	if err := pw.pw.Write(pt); err != nil {
+		return err
+	}
+	pw.pending = append(pw.pending, measurementSeries{name: pt.Name(), key: seriesKey(pt.Name(), pt.Tags())})
+	return nil
+}
+
+func (pw *countingPointsWriter) Flush() error {
+	pending := pw.pending
+	pw.pending = pw.pending[:0]
+	if err := pw.pw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range pending {
+		m, ok := pw.measurements[s.name]
+		if !ok {
+			m = &measurementCount{series: make(map[string]bool)}
+			pw.measurements[s.name] = m
+		}
+		m.points++
+		m.series[s.key] = true
+	}
+	return nil
+}
+
+func (pw *countingPointsWriter) Close() error {
+	if closer, ok := pw.pw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (pw *countingPointsWriter) sendStats() (sendStats, bool) {
+	return writerStats(pw.pw)
+}
+
+// runStats describes a run for the automation that wraps the tool.
+type runStats struct {
+	Files        int                         `json:"files"`
+	FilesFailed  int                         `json:"files_failed"`
+	Points       int                         `json:"points"`
+	Series       int                         `json:"series"`
+	Measurements map[string]measurementStats `json:"measurements"`
+	Tests        int                         `json:"tests"`
+	Failures     int                         `json:"failures"`
+	Errors       int                         `json:"errors"`
+	Skipped      int                         `json:"skipped"`
+	Elapsed      float64                     `json:"elapsed_seconds"`
+	Write        *writeStats                 `json:"write,omitempty"`
+	Messages     []string                    `json:"error_messages"`
+}
+
+type measurementStats struct {
+	Points int `json:"points"`
+	Series int `json:"series"`
+}
+
+type writeStats struct {
+	Requests   int     `json:"requests"`
+	Bytes      int     `json:"bytes"`
+	AvgLatency float64 `json:"avg_latency_seconds"`
+	MaxLatency float64 `json:"max_latency_seconds"`
+}
+
+// writeRunStats writes the statistics of the run as json to the path, or to
+// stdout when the path is -.
+func writeRunStats(path string, c *converter, pw *countingPointsWriter, files, failed int, messages []string, elapsed time.Duration) error {
+	stats := runStats{
+		Files:        files,
+		FilesFailed:  failed,
+		Measurements: make(map[string]measurementStats),
+		Tests:        c.run.tests,
+		Failures:     c.run.failures,
+		Errors:       c.run.errors,
+		Skipped:      c.run.skipped,
+		Elapsed:      elapsed.Seconds(),
+		Messages:     messages,
+	}
+	if stats.Messages == nil {
+		stats.Messages = []string{}
+	}
+	for name, m := range pw.measurements {
+		stats.Measurements[name] = measurementStats{Points: m.points, Series: len(m.series)}
+		stats.Points += m.points
+		stats.Series += len(m.series)
+	}
+	if s, ok := pw.sendStats(); ok {
+		stats.Write = &writeStats{
+			Requests:   s.requests,
+			Bytes:      s.bytes,
+			MaxLatency: s.maxLatency.Seconds(),
+		}
+		if s.requests > 0 {
+			stats.Write.AvgLatency = (s.latency / time.Duration(s.requests)).Seconds()
+		}
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// tagSanitizer cleans up tag values before they are written.
+type tagSanitizer struct {
+	// clean trims surrounding whitespace and replaces newlines and tabs
+	// with spaces.
+	clean bool
+
+	// maxLength truncates values longer than this many bytes. Values are
+	// not truncated when it is zero.
+	maxLength int
+}
+
+var tagReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+func (s *tagSanitizer) sanitize(v string) string {
+	if s.clean {
+		v = strings.TrimSpace(tagReplacer.Replace(v))
+	}
+	if s.maxLength > 0 && len(v) > s.maxLength {
+		n := s.maxLength
+		for n > 0 && !utf8.RuneStart(v[n]) {
+			n--
+		}
+		v = v[:n]
+	}
+	return v
+}
+
+// seriesGuard tracks the distinct series written during a run and warns or
+// fails when there are too many of them.
+type seriesGuard struct {
+	// warn prints a warning once the number of series exceeds it.
+	warn int
+
+	// max returns an error once the number of series exceeds it.
+	max int
+
+	series   map[string]struct{}
+	warned   bool
+	exceeded bool
+}
+
+// add records the series for a point.
+func (g *seriesGuard) add(name string, tags map[string]string) error {
+	if g.warn <= 0 && g.max <= 0 {
+		return nil
+	}
+	if g.series == nil {
+		g.series = make(map[string]struct{})
+	}
+
+	g.series[seriesKey(name, tags)] = struct{}{}
+
+	n := len(g.series)
+	if g.max > 0 && n > g.max {
+		g.exceeded = true
+		return fmt.Errorf("Run would write more than %d series", g.max)
+	}
+	if g.warn > 0 && n > g.warn && !g.warned {
+		logger.Warnf("Run is writing more than %d series", g.warn)
+		g.warned = true
+	}
+	return nil
+}
+
+// seriesKey returns a key that identifies the series of a point.
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var key strings.Builder
+	key.WriteString(name)
+	for _, k := range keys {
+		key.WriteByte(',')
+		key.WriteString(k)
+		key.WriteByte('=')
+		key.WriteString(tags[k])
+	}
+	return key.String()
+}
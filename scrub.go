@@ -0,0 +1,65 @@
+package main
+
+import "regexp"
+
+// scrubPresets are the named patterns that may be passed to --scrub.
+var scrubPresets = map[string]string{
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"ipv4":  `\b(?:\d{1,3}\.){3}\d{1,3}\b`,
+	"uuid":  `\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`,
+}
+
+// scrubber redacts identifiers from a report before it is converted.
+type scrubber struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// add adds a pattern which may either be the name of a preset or a regex.
+func (s *scrubber) add(pattern string) error {
+	if preset, ok := scrubPresets[pattern]; ok {
+		pattern = preset
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	s.patterns = append(s.patterns, re)
+	return nil
+}
+
+func (s *scrubber) scrubString(v string) string {
+	for _, re := range s.patterns {
+		v = re.ReplaceAllLiteralString(v, s.replacement)
+	}
+	return v
+}
+
+// scrub redacts the names, messages, and properties of the report.
+func (s *scrubber) scrub(tests *TestSuites) {
+	if len(s.patterns) == 0 {
+		return
+	}
+	for i := range tests.Items {
+		testsuite := &tests.Items[i]
+		testsuite.Name = s.scrubString(testsuite.Name)
+		for j := range testsuite.Properties.Items {
+			p := &testsuite.Properties.Items[j]
+			p.Value = s.scrubString(p.Value)
+		}
+		for j := range testsuite.TestCases {
+			testcase := &testsuite.TestCases[j]
+			testcase.ClassName = s.scrubString(testcase.ClassName)
+			testcase.Name = s.scrubString(testcase.Name)
+			for _, f := range []*Failure{testcase.Failure, testcase.Error} {
+				if f != nil {
+					f.Message = s.scrubString(f.Message)
+					f.Text = s.scrubString(f.Text)
+				}
+			}
+			if testcase.Skipped != nil {
+				testcase.Skipped.Message = s.scrubString(testcase.Skipped.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,844 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+)
+
+// serveOptions are the options of the serve command in addition to the
+// ingest options.
+type serveOptions struct {
+	listen       string
+	grpcListen   string
+	projectsFile string
+	basicAuth    []string
+	tlsCert      string
+	tlsKey       string
+	tlsClientCA  string
+
+	walDir            string
+	walReplayInterval time.Duration
+
+	shutdownTimeout time.Duration
+	readyMaxWAL     int
+
+	maxUploadSize string
+	rateLimit     string
+
+	webhooks webhookConfig
+}
+
+func addServeFlags(fs *pflag.FlagSet) *serveOptions {
+	o := &serveOptions{}
+	fs.StringVar(&o.listen, "listen", ":8080", "address to listen on for report uploads")
+	fs.StringVar(&o.grpcListen, "grpc-listen", "", "address to serve the grpc ingestion api of proto/ingest.proto on")
+	fs.StringVar(&o.projectsFile, "projects", "", "yaml file with the settings of each project, such as the bearer token required to upload its reports")
+	fs.StringArrayVar(&o.basicAuth, "basic-auth", nil, "user:password allowed to upload the reports of any project with basic auth (may be repeated)")
+	fs.StringVar(&o.tlsCert, "tls-cert", "", "certificate file to serve https with")
+	fs.StringVar(&o.tlsKey, "tls-key", "", "private key file of the --tls-cert certificate")
+	fs.StringVar(&o.tlsClientCA, "tls-client-ca", "", "require client certificates signed by the certificate authorities in this file")
+	fs.StringVar(&o.walDir, "wal-dir", "", "store the points of uploads that cannot be written in this directory and write them once influxdb is available")
+	fs.DurationVar(&o.walReplayInterval, "wal-replay-interval", 30*time.Second, "how often to try writing the points stored in --wal-dir")
+	fs.DurationVar(&o.shutdownTimeout, "shutdown-timeout", 30*time.Second, "how long to wait for the uploads in progress when stopping")
+	fs.IntVar(&o.readyMaxWAL, "ready-max-wal", 100, "report the server as not ready once more than this many writes are stored in --wal-dir")
+	fs.StringVar(&o.maxUploadSize, "max-upload-size", "64MB", "largest upload to accept, such as 512KB or 64MB (0 for no limit)")
+	fs.StringVar(&o.rateLimit, "rate-limit", "", "uploads allowed for each project token, user, or address, such as 10/m (s, m, or h)")
+	fs.StringVar(&o.webhooks.githubSecret, "github-webhook-secret", "", "secret of the github webhook that sends workflow_run events to /webhooks/github")
+	fs.StringVar(&o.webhooks.gitlabSecret, "gitlab-webhook-secret", "", "secret token of the gitlab webhook that sends pipeline events to /webhooks/gitlab")
+	fs.StringVar(&o.webhooks.gitlabToken, "gitlab-token", "", "gitlab token used to download the artifacts of pipelines")
+	fs.StringVar(&o.webhooks.gitlabURL, "gitlab-url", "https://gitlab.com", "url of the gitlab server")
+	fs.StringVar(&o.webhooks.artifactPattern, "artifact-pattern", "*.xml", "glob matching the file name of the reports within the artifacts of a webhook run")
+	return o
+}
+
+// serve runs an http server that accepts report uploads and writes their
+// points to influxdb so the jobs uploading the reports do not need the
+// credentials of the server. The ingest options apply to every upload.
+// With --grpc-listen the reports are also accepted through the Ingest
+// service of proto/ingest.proto.
+func serve(args []string) {
+	fs := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "serve [options]")
+	o := newIngestOptions(fs)
+	so := addServeFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		logger.Exitf(exitUsage, "The serve command does not take any arguments")
+	}
+	if (so.tlsCert == "") != (so.tlsKey == "") {
+		logger.Exitf(exitUsage, "The --tls-cert and --tls-key options must be used together")
+	} else if so.tlsClientCA != "" && so.tlsCert == "" {
+		logger.Exitf(exitUsage, "The --tls-client-ca option requires --tls-cert")
+	}
+
+	c, precision := newIngestConverter(fs, o, nil)
+	s := &server{
+		conv:      c,
+		opts:      o,
+		precision: precision,
+		users:     make(map[string]string),
+		maxWAL:    so.readyMaxWAL,
+		metrics:   newServerMetrics(),
+	}
+	if so.projectsFile != "" {
+		projects, err := readProjects(so.projectsFile)
+		if err != nil {
+			logger.Exitf(exitUsage, "Unable to read projects %s: %s", so.projectsFile, err)
+		}
+		s.projects = projects
+	}
+	for _, v := range so.basicAuth {
+		i := strings.IndexByte(v, ':')
+		if i <= 0 {
+			logger.Exitf(exitUsage, "Invalid --basic-auth value: expected user:password")
+		}
+		s.users[v[:i]] = v[i+1:]
+	}
+	maxUpload, err := parseByteSize(so.maxUploadSize)
+	if err != nil {
+		logger.Exitf(exitUsage, "Invalid --max-upload-size value: %s", err)
+	}
+	s.maxUpload = maxUpload
+	if so.rateLimit != "" {
+		n, per, err := parseRateLimit(so.rateLimit)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --rate-limit value: %s", err)
+		}
+		s.limiter = newRateLimiter(n, per)
+	}
+	s.webhooks = so.webhooks
+	if s.webhooks.githubSecret != "" {
+		s.webhooks.githubToken = *o.githubToken
+		if s.webhooks.githubToken == "" {
+			s.webhooks.githubToken = os.Getenv("GITHUB_TOKEN")
+		}
+		if s.webhooks.githubToken == "" {
+			logger.Exitf(exitUsage, "Must specify a github token to download the artifacts of workflow runs")
+		}
+	}
+	if s.webhooks.gitlabSecret != "" && s.webhooks.gitlabToken == "" {
+		logger.Exitf(exitUsage, "Must specify a gitlab token to download the artifacts of pipelines")
+	}
+	if _, err := path.Match(s.webhooks.artifactPattern, ""); err != nil {
+		logger.Exitf(exitUsage, "Invalid --artifact-pattern value: %s", err)
+	}
+	if !s.authRequired() && so.tlsClientCA == "" {
+		logger.Warnf("Accepting uploads without authentication")
+	}
+
+	// The projects may write to their own databases, so each of them is
+	// created or checked before accepting uploads.
+	conns := []*connectionOptions{o.conn}
+	for _, p := range s.projects {
+		if p.database != "" || p.retentionPolicy != "" {
+			conns = append(conns, p.connection(o.conn))
+		}
+	}
+	for _, conn := range conns {
+		if o.conn.createDatabase {
+			if err := conn.ensureDatabase(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		} else if o.conn.createBucket {
+			if err := conn.ensureBucket(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		}
+		if *o.check {
+			if err := conn.check(); err != nil {
+				logger.Exitf(exitConnection, "%s", err)
+			}
+		}
+	}
+
+	client, err := o.conn.httpClient()
+	if err != nil {
+		logger.Exitf(exitConnection, "Could not create HTTP client: %s", err)
+	}
+	s.client = client
+
+	if so.walDir != "" {
+		if s.wal, err = openWriteAheadLog(so.walDir); err != nil {
+			logger.Fatalf("Unable to open the write-ahead log: %s", err)
+		}
+		s.stopReplay = make(chan struct{})
+		s.replayDone = make(chan struct{})
+		go s.replayLoop(so.walReplayInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest", s.metrics.instrument(s.ingest))
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	if s.webhooks.githubSecret != "" {
+		mux.HandleFunc("/webhooks/github", s.githubWebhook)
+	}
+	if s.webhooks.gitlabSecret != "" {
+		mux.HandleFunc("/webhooks/gitlab", s.gitlabWebhook)
+	}
+
+	srv := &http.Server{
+		Addr:     so.listen,
+		Handler:  mux,
+		ErrorLog: log.New(serverErrorLog{}, "", 0),
+	}
+	if so.tlsClientCA != "" {
+		tlsConfig, err := clientCATLSConfig(so.tlsClientCA)
+		if err != nil {
+			logger.Exitf(exitUsage, "Invalid --tls-client-ca value: %s", err)
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	var grpcListener net.Listener
+	if so.grpcListen != "" {
+		var tlsConfig *tls.Config
+		if so.tlsCert != "" {
+			cert, err := tls.LoadX509KeyPair(so.tlsCert, so.tlsKey)
+			if err != nil {
+				logger.Exitf(exitUsage, "Invalid --tls-cert value: %s", err)
+			}
+			tlsConfig = &tls.Config{}
+			if srv.TLSConfig != nil {
+				tlsConfig = srv.TLSConfig.Clone()
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if grpcListener, err = net.Listen("tcp", so.grpcListen); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		s.grpcServer = s.newGRPCServer(tlsConfig)
+	}
+
+	// The server is stopped on SIGINT or SIGTERM, which makes it return
+	// ErrServerClosed, and the exit code is sent once the shutdown is done.
+	shutdown := make(chan int, 1)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		logger.Info("Received signal, shutting down", "signal", <-sig)
+		shutdown <- s.shutdown(srv, so.shutdownTimeout)
+	}()
+
+	if s.grpcServer != nil {
+		go func() {
+			logger.Info("Listening for grpc calls", "addr", so.grpcListen, "tls", so.tlsCert != "")
+			if err := s.grpcServer.Serve(grpcListener); err != nil {
+				logger.Fatalf("%s", err)
+			}
+		}()
+	}
+	logger.Info("Listening for reports", "addr", so.listen, "tls", so.tlsCert != "")
+	if so.tlsCert != "" {
+		err = srv.ListenAndServeTLS(so.tlsCert, so.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		logger.Fatalf("%s", err)
+	}
+	exit(<-shutdown)
+}
+
+// shutdown stops accepting uploads, waits up to the timeout for the
+// uploads, grpc calls, and webhook runs in progress, and makes a last
+// attempt to write the points stored in the write-ahead log. It returns
+// exitPartialWrite when uploads, grpc calls, or webhook runs in progress
+// were dropped. Points left in the write-ahead log are written by the next
+// server using the same directory.
+func (s *server) shutdown(srv *http.Server, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	code := 0
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Errorf("Dropped the uploads in progress: %s", err)
+		code = exitPartialWrite
+	}
+	if s.grpcServer != nil {
+		if err := s.stopGRPC(ctx); err != nil {
+			logger.Errorf("Dropped the grpc calls in progress: %s", err)
+			code = exitPartialWrite
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Errorf("Dropped the webhook runs in progress: %s", ctx.Err())
+		code = exitPartialWrite
+	}
+	if s.wal == nil {
+		return code
+	}
+
+	close(s.stopReplay)
+	<-s.replayDone
+	s.replayWAL()
+	if paths, err := s.wal.pending(); err != nil {
+		logger.Errorf("Could not list the stored points: %s", err)
+	} else if len(paths) > 0 {
+		logger.Warnf("Kept %d writes in %s that could not be written yet", len(paths), s.wal.dir)
+	}
+	return code
+}
+
+// serverErrorLog writes the errors of the http server, such as failed tls
+// handshakes, as debug messages since they are caused by the clients.
+type serverErrorLog struct{}
+
+func (serverErrorLog) Write(p []byte) (int, error) {
+	logger.Debug("HTTP server error", "err", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// clientCATLSConfig returns the tls config that requires the clients to
+// present a certificate signed by one of the authorities in the file.
+func clientCATLSConfig(path string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}, nil
+}
+
+// server writes the points for uploaded reports. Each upload is written
+// with its own copy of conv so the uploads are separate runs.
+type server struct {
+	conv      *converter
+	opts      *ingestOptions
+	client    *http.Client
+	precision string
+
+	// projects holds the settings of the projects by name and users the
+	// password of each user allowed to upload with basic auth.
+	projects map[string]*projectConfig
+	users    map[string]string
+
+	// wal stores the points of uploads that could not be written. It is
+	// nil when the points are not stored.
+	wal        *writeAheadLog
+	stopReplay chan struct{}
+	replayDone chan struct{}
+
+	// maxWAL is the number of stored writes above which the server is
+	// not ready.
+	maxWAL int
+
+	metrics *serverMetrics
+
+	// maxUpload is the largest body accepted in bytes and limiter limits
+	// the uploads of each client. Neither is limited when it is zero or
+	// nil.
+	maxUpload int64
+	limiter   *rateLimiter
+
+	// webhooks holds the settings of the ci webhooks and background the
+	// runs of the webhooks whose reports are still being written.
+	webhooks   webhookConfig
+	background sync.WaitGroup
+
+	// grpcServer serves the Ingest service when --grpc-listen is set.
+	grpcServer *grpc.Server
+}
+
+// authRequired reports whether uploads must be authenticated, which is the
+// case once any token or user is configured.
+func (s *server) authRequired() bool {
+	if len(s.users) > 0 {
+		return true
+	}
+	for _, p := range s.projects {
+		if p.token != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized reports whether the request may upload the reports of the
+// project. A bearer token must be the token of the project while a user
+// with basic auth may upload the reports of any project.
+func (s *server) authorized(r *http.Request, project string) bool {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		p, ok := s.projects[project]
+		return ok && p.token != "" && secureCompare(strings.TrimPrefix(auth, "Bearer "), p.token)
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		want, ok := s.users[username]
+		return ok && secureCompare(password, want)
+	}
+	return !s.authRequired()
+}
+
+// tokenProject returns the project with the bearer token of the request.
+// It returns an empty string if there is no such project.
+func (s *server) tokenProject(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	for name, p := range s.projects {
+		if p.token != "" && secureCompare(token, p.token) {
+			return name
+		}
+	}
+	return ""
+}
+
+// clientKey identifies the client of an authorized upload for the rate
+// limit: the project of a token, the user of basic auth, or the address of
+// an unauthenticated client.
+func (s *server) clientKey(r *http.Request, project string) string {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return "project:" + project
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		return "user:" + username
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// secureCompare compares the strings in constant time so the credentials
+// cannot be guessed from the time it takes to reject them.
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// ingestResponse is the body of a successful upload.
+type ingestResponse struct {
+	Project  string `json:"project"`
+	Reports  int    `json:"reports"`
+	Tests    int    `json:"tests"`
+	Failures int    `json:"failures"`
+	Errors   int    `json:"errors"`
+	Skipped  int    `json:"skipped"`
+	Points   int    `json:"points"`
+
+	// Queued is set when the points could not be written yet and were
+	// stored to be written later.
+	Queued bool `json:"queued,omitempty"`
+}
+
+// ingest handles POST /ingest?project=<name>. The body is a report, which
+// may be gzip compressed, or a multipart form with a report in each file.
+// The points of an upload are only written if every report in it can be
+// converted. The project is added to every point as the project tag along
+// with the tags of the project, and the points are written to the database
+// of the project. The project may be left out when a project token is
+// used. The upload must be authorized for the project when authentication
+// is required.
+func (s *server) ingest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		project = s.tokenProject(r)
+	}
+	if !s.authorized(r, project) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="influx-junit"`)
+		if len(s.users) > 0 {
+			w.Header().Add("WWW-Authenticate", `Basic realm="influx-junit"`)
+		}
+		logger.Debug("Rejected upload", "project", project, "remote", r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if project == "" {
+		writeError(w, http.StatusBadRequest, "Must specify a project")
+		return
+	}
+	if s.limiter != nil {
+		if ok, wait := s.limiter.allow(s.clientKey(r, project), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Too many uploads")
+			return
+		}
+	}
+	if s.maxUpload > 0 {
+		if r.ContentLength > s.maxUpload {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d bytes", s.maxUpload))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	}
+
+	reports, err := readUploadedReports(r, newUploadBudget(s.maxUpload))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d bytes", s.maxUpload))
+			return
+		}
+		s.metrics.addParseError()
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if len(reports) == 0 {
+		writeError(w, http.StatusBadRequest, "No reports were uploaded")
+		return
+	}
+
+	code, resp, err := s.writeReports(project, reports, nil)
+	if err != nil {
+		writeError(w, code, err.Error())
+		return
+	}
+	writeJSON(w, code, resp)
+}
+
+// writeReports converts and writes the reports of a project with the tags
+// added to every point. It returns the status code of the response along
+// with the totals of the reports, or with the error.
+func (s *server) writeReports(project string, reports []*TestSuites, tags map[string]string) (int, *ingestResponse, error) {
+	s.metrics.addReports(len(reports))
+
+	conn := s.opts.conn
+	c := s.conv.clone()
+	c.tags["project"] = project
+	for k, v := range tags {
+		c.tags[k] = v
+	}
+	if p, ok := s.projects[project]; ok {
+		conn = p.connection(conn)
+		for k, v := range p.tags {
+			c.tags[k] = v
+		}
+	}
+
+	now := time.Now()
+	var buf bufferedPointsWriter
+	for _, tests := range reports {
+		if err := c.writeTestSuites(&buf, tests, "", now); err != nil {
+			s.metrics.addParseError()
+			return http.StatusBadRequest, nil, err
+		}
+	}
+	if *s.opts.runSummary {
+		if err := c.writeRunSummary(&buf, *s.opts.runMeasurement, now); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+	}
+
+	start := time.Now()
+	body := encodeLineProtocol(buf.points, s.precision)
+	code, queued := http.StatusOK, false
+	if err := s.write(conn, s.precision, body); err != nil {
+		if s.wal == nil || !retryable(err) {
+			logger.Errorf("Could not write points for project %s: %s", project, err)
+			return http.StatusBadGateway, nil, fmt.Errorf("Could not write points: %s", err)
+		}
+		h := walHeader{Database: conn.database, RetentionPolicy: conn.retentionPolicy, Precision: s.precision}
+		if err := s.wal.append(h, body); err != nil {
+			logger.Errorf("Could not store points for project %s: %s", project, err)
+			return http.StatusInternalServerError, nil, fmt.Errorf("Could not store points: %s", err)
+		}
+		logger.Warnf("Could not write points for project %s, stored them to write later: %s", project, err)
+		code, queued = http.StatusAccepted, true
+	} else {
+		s.metrics.addPoints(c.points)
+		logger.Info("Wrote upload", "project", project, "reports", len(reports), "points", c.points, "elapsed", time.Since(start))
+	}
+
+	return code, &ingestResponse{
+		Project:  project,
+		Reports:  len(reports),
+		Tests:    c.run.tests,
+		Failures: c.run.failures,
+		Errors:   c.run.errors,
+		Skipped:  c.run.skipped,
+		Points:   c.points,
+		Queued:   queued,
+	}, nil
+}
+
+// healthz handles GET /healthz, which succeeds as long as the server is
+// running.
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyResponse is the body of a readiness check.
+type readyResponse struct {
+	Status     string `json:"status"`
+	InfluxDB   string `json:"influxdb,omitempty"`
+	WALPending int    `json:"wal_pending"`
+}
+
+// readyz handles GET /readyz, which succeeds when influxdb can be reached
+// and the write-ahead log is not backed up, so uploads are only sent to a
+// server that can write them.
+func (s *server) readyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Status: "ok"}
+	if err := s.ping(r.Context()); err != nil {
+		resp.Status, resp.InfluxDB = "unavailable", err.Error()
+	}
+	if s.wal != nil {
+		paths, err := s.wal.pending()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.WALPending = len(paths)
+		if len(paths) > s.maxWAL {
+			resp.Status = "unavailable"
+		}
+	}
+
+	code := http.StatusOK
+	if resp.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, &resp)
+}
+
+// serveMetrics handles GET /metrics with the metrics in the prometheus
+// text format.
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	walPending := -1
+	if s.wal != nil {
+		if paths, err := s.wal.pending(); err == nil {
+			walPending = len(paths)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.writeTo(w, walPending)
+}
+
+// ping checks that the influxdb server responds to /ping.
+func (s *server) ping(ctx context.Context) error {
+	u, err := url.Parse(s.opts.conn.host)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, "ping")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping returned %s", resp.Status)
+	}
+	return nil
+}
+
+// write writes the points encoded as line protocol with timestamps in the
+// precision to the database of conn.
+func (s *server) write(conn *connectionOptions, precision string, body []byte) error {
+	pw, err := newInfluxdbPointsWriter(conn, influxdb.BatchPointsConfig{
+		Precision:       precision,
+		Database:        conn.database,
+		RetentionPolicy: conn.retentionPolicy,
+	})
+	if err != nil {
+		return err
+	}
+	// The client is shared so the connections to the server are reused.
+	pw.client = s.client
+	err = pw.send(body)
+	s.metrics.addWrite(pw.stats, err)
+	return err
+}
+
+// replayLoop writes the points stored in the write-ahead log at every
+// interval until stopReplay is closed.
+func (s *server) replayLoop(interval time.Duration) {
+	defer close(s.replayDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.replayWAL()
+		case <-s.stopReplay:
+			return
+		}
+	}
+}
+
+// replayWAL writes the points stored in the write-ahead log until the
+// server is unavailable again.
+func (s *server) replayWAL() {
+	n, err := s.wal.replay(func(h walHeader, body []byte) error {
+		conn := *s.opts.conn
+		conn.database, conn.retentionPolicy = h.Database, h.RetentionPolicy
+		if err := s.write(&conn, h.Precision, body); err != nil {
+			return err
+		}
+		s.metrics.addPoints(bytes.Count(body, []byte("\n")))
+		return nil
+	})
+	if n > 0 {
+		logger.Info("Wrote stored points", "writes", n)
+	}
+	if err != nil {
+		logger.Debug("Could not write stored points", "err", err)
+	}
+}
+
+// readUploadedReports decodes the reports in the body of an upload. The
+// decompressed reports may not be larger than the budget in total.
+func readUploadedReports(r *http.Request, budget *uploadBudget) ([]*TestSuites, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		tests, err := decodeUpload(r.Body, budget)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode report: %w", err)
+		}
+		return []*TestSuites{tests}, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var reports []*TestSuites
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return reports, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// Form values that are not files are ignored.
+		if part.FileName() == "" {
+			continue
+		}
+		tests, err := decodeUpload(part, budget)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode report %s: %w", part.FileName(), err)
+		}
+		reports = append(reports, tests)
+	}
+}
+
+// decodeUpload decodes a report that may be gzip compressed. Compression
+// is detected from the content instead of the Content-Encoding header so
+// compressed files within a multipart form are also read. The budget
+// limits the size of the decompressed report.
+func decodeUpload(r io.Reader, budget *uploadBudget) (*TestSuites, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return decodeTestSuites(budget.reader(gz))
+	}
+	return decodeTestSuites(br)
+}
+
+// uploadBudget limits the total size of the decompressed reports of an
+// upload so a small compressed upload cannot expand without bound. A nil
+// budget has no limit.
+type uploadBudget struct {
+	limit, remaining int64
+}
+
+// newUploadBudget returns a budget of limit bytes, or nil when the limit
+// is not positive.
+func newUploadBudget(limit int64) *uploadBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &uploadBudget{limit: limit, remaining: limit}
+}
+
+// reader returns a reader that takes the bytes read from r out of the
+// budget and fails with an *http.MaxBytesError once it is used up.
+func (b *uploadBudget) reader(r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *uploadBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	// One byte more than the budget is allowed so a report that uses it
+	// exactly can still reach its end.
+	left := r.budget.remaining + 1
+	if left <= 0 {
+		return 0, &http.MaxBytesError{Limit: r.budget.limit}
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := r.r.Read(p)
+	r.budget.remaining -= int64(n)
+	if r.budget.remaining < 0 {
+		return n, &http.MaxBytesError{Limit: r.budget.limit}
+	}
+	return n, err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
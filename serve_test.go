@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServerAuthorized(t *testing.T) {
+	secured := &server{
+		projects: map[string]*projectConfig{
+			"api": {token: "api-token"},
+			"web": {token: "web-token"},
+			"cli": {},
+		},
+		users: map[string]string{"ci": "hunter2"},
+	}
+	open := &server{
+		projects: map[string]*projectConfig{"api": {}},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		s       *server
+		project string
+		auth    func(r *http.Request)
+		want    bool
+		// tokenProject is the project of the bearer token.
+		tokenProject string
+	}{
+		{
+			name:         "Token",
+			s:            secured,
+			project:      "api",
+			auth:         func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-token") },
+			want:         true,
+			tokenProject: "api",
+		},
+		{
+			name:         "TokenOfOtherProject",
+			s:            secured,
+			project:      "api",
+			auth:         func(r *http.Request) { r.Header.Set("Authorization", "Bearer web-token") },
+			want:         false,
+			tokenProject: "web",
+		},
+		{
+			name:    "ProjectWithoutToken",
+			s:       secured,
+			project: "cli",
+			auth:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") },
+			want:    false,
+		},
+		{
+			name:    "UnknownProject",
+			s:       secured,
+			project: "missing",
+			auth:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-token") },
+			want:    false,
+			// The token still names its project when the request names
+			// another one.
+			tokenProject: "api",
+		},
+		{
+			name:    "BasicAuth",
+			s:       secured,
+			project: "cli",
+			auth:    func(r *http.Request) { r.SetBasicAuth("ci", "hunter2") },
+			want:    true,
+		},
+		{
+			name:    "WrongPassword",
+			s:       secured,
+			project: "cli",
+			auth:    func(r *http.Request) { r.SetBasicAuth("ci", "hunter3") },
+			want:    false,
+		},
+		{
+			name:    "UnknownUser",
+			s:       secured,
+			project: "cli",
+			auth:    func(r *http.Request) { r.SetBasicAuth("someone", "hunter2") },
+			want:    false,
+		},
+		{
+			name:    "Anonymous",
+			s:       secured,
+			project: "cli",
+			want:    false,
+		},
+		{
+			name:    "AnonymousWithoutAuth",
+			s:       open,
+			project: "api",
+			want:    true,
+		},
+		{
+			name:    "TokenWithoutAuth",
+			s:       open,
+			project: "api",
+			auth:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer anything") },
+			want:    false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/ingest", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.auth != nil {
+				tt.auth(r)
+			}
+			if got := tt.s.authorized(r, tt.project); got != tt.want {
+				t.Errorf("authorized = %t, want %t", got, tt.want)
+			}
+			if got := tt.s.tokenProject(r); got != tt.tokenProject {
+				t.Errorf("tokenProject = %q, want %q", got, tt.tokenProject)
+			}
+		})
+	}
+}
+
+func TestServerClientKey(t *testing.T) {
+	s := &server{}
+	for _, tt := range []struct {
+		name       string
+		remoteAddr string
+		auth       func(r *http.Request)
+		want       string
+	}{
+		{
+			name: "Token",
+			auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-token") },
+			want: "project:api",
+		},
+		{
+			name: "BasicAuth",
+			auth: func(r *http.Request) { r.SetBasicAuth("ci", "hunter2") },
+			want: "user:ci",
+		},
+		{
+			name:       "Address",
+			remoteAddr: "10.0.0.1:5123",
+			want:       "addr:10.0.0.1",
+		},
+		{
+			name:       "AddressWithoutPort",
+			remoteAddr: "10.0.0.1",
+			want:       "addr:10.0.0.1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/ingest", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			if tt.auth != nil {
+				tt.auth(r)
+			}
+			if got := s.clientKey(r, "api"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+)
+
+// slowestOptions are the options of the slowest report.
+type slowestOptions struct {
+	*reportOptions
+	top int
+}
+
+func addSlowestFlags(fs *pflag.FlagSet) *slowestOptions {
+	o := &slowestOptions{reportOptions: addReportFlags(fs)}
+	fs.IntVar(&o.top, "top", 20, "number of testcases to list; 0 lists all of them")
+	return o
+}
+
+// slowTest holds the durations of a testcase in seconds from the oldest
+// run to the newest.
+type slowTest struct {
+	suite, name string
+	durations   []float64
+}
+
+func (t *slowTest) mean() float64 {
+	return meanOf(t.durations)
+}
+
+func (t *slowTest) max() float64 {
+	max := 0.0
+	for _, d := range t.durations {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// trend compares the mean duration of the newer half of the runs with the
+// older half. A change of less than 10% is flat.
+func (t *slowTest) trend() string {
+	n := len(t.durations)
+	if n < 2 {
+		return "-"
+	}
+	older, newer := meanOf(t.durations[:n/2]), meanOf(t.durations[n/2:])
+	switch {
+	case older == 0 && newer == 0:
+		return "flat"
+	case newer > older*1.1:
+		return "slower"
+	case newer < older*0.9:
+		return "faster"
+	}
+	return "flat"
+}
+
+func meanOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// reportSlowest lists the testcases with the highest mean duration. The
+// durations are read from the report files given as arguments, which are
+// treated as runs from the oldest to the newest, or from the results in
+// influxdb when there are no arguments. Skipped testcases are left out.
+func reportSlowest(args []string) {
+	fs := pflag.NewFlagSet("report slowest", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "report slowest [options] [<file>...]")
+	o := addSlowestFlags(fs)
+	fs.Parse(args)
+	o.validate(fs)
+
+	tests := make(map[[2]string]*slowTest)
+	add := func(suite, name string, seconds float64) {
+		key := [2]string{suite, name}
+		t, ok := tests[key]
+		if !ok {
+			t = &slowTest{suite: suite, name: name}
+			tests[key] = t
+		}
+		t.durations = append(t.durations, seconds)
+	}
+
+	if fs.NArg() > 0 {
+		for _, path := range fs.Args() {
+			report, err := readTestSuitesFile(path)
+			if err != nil {
+				logger.Exitf(exitParse, "%s", err)
+			}
+			for _, testsuite := range report.Items {
+				for _, testcase := range testsuite.TestCases {
+					if testcase.Skipped == nil {
+						add(testsuite.Name, testcase.Name, testcase.Duration)
+					}
+				}
+			}
+		}
+	} else {
+		client := o.connect()
+		defer client.Close()
+		stmt := fmt.Sprintf(`SELECT "duration", "status" FROM %s WHERE %s GROUP BY "suite_name", "test_name"`, o.source(), o.where())
+		err := queryRows(client, o.conn.database, stmt, func(tags map[string]string, values map[string]interface{}) {
+			if status, _ := values["status"].(string); status == "skipped" {
+				return
+			}
+			if d, ok := o.seconds(values["duration"]); ok {
+				add(tags["suite_name"], tags["test_name"], d)
+			}
+		})
+		if err != nil {
+			logger.Exitf(exitConnection, "Could not query the results: %s", err)
+		}
+	}
+
+	slowest := make([]*slowTest, 0, len(tests))
+	for _, t := range tests {
+		slowest = append(slowest, t)
+	}
+	sort.Slice(slowest, func(i, j int) bool {
+		a, b := slowest[i], slowest[j]
+		if am, bm := a.mean(), b.mean(); am != bm {
+			return am > bm
+		}
+		if a.suite != b.suite {
+			return a.suite < b.suite
+		}
+		return a.name < b.name
+	})
+	if o.top > 0 && len(slowest) > o.top {
+		slowest = slowest[:o.top]
+	}
+
+	table := &reportTable{columns: []string{"suite", "test", "runs", "mean", "max", "last", "trend"}}
+	for _, t := range slowest {
+		table.add(t.suite, t.name, len(t.durations), t.mean(), t.max(), t.durations[len(t.durations)-1], t.trend())
+	}
+	o.writeTable(table)
+}
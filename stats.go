@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// addDurationStats adds the duration percentile and histogram fields for
+// the testcases of a suite.
+func (c *converter) addDurationStats(fields map[string]interface{}, testsuite *TestSuite) {
+	if !c.suitePercentiles && len(c.suiteHistogram) == 0 {
+		return
+	}
+	if len(testsuite.TestCases) == 0 {
+		return
+	}
+
+	durations := make([]float64, len(testsuite.TestCases))
+	for i, testcase := range testsuite.TestCases {
+		durations[i] = testcase.Duration
+	}
+	sort.Float64s(durations)
+
+	if c.suitePercentiles {
+		fields["duration_p50"] = c.duration(percentile(durations, 50))
+		fields["duration_p90"] = c.duration(percentile(durations, 90))
+		fields["duration_p99"] = c.duration(percentile(durations, 99))
+		fields["duration_max"] = c.duration(durations[len(durations)-1])
+	}
+
+	// The histogram buckets are cumulative like prometheus histograms: each
+	// bucket counts the testcases that took at most the bucket bound.
+	for _, bound := range c.suiteHistogram {
+		n := sort.Search(len(durations), func(i int) bool {
+			return durations[i] > bound
+		})
+		fields["duration_le_"+strconv.FormatFloat(bound, 'f', -1, 64)] = n
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// goTestEvent is a line of the output of go test -json.
+type goTestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// writeGoTestEvents reads the output of go test -json and writes the point
+// for each test as soon as it finishes. The summary of a package is written
+// when the package finishes. Lines that are not events, such as build
+// errors, are ignored.
+//
+// A write that fails is logged and the remaining events are still read so
+// the test run is not blocked on a full pipe.
+func (c *converter) writeGoTestEvents(pw PointsWriter, r io.Reader) error {
+	c.run.files++
+
+	var (
+		suites  = make(map[string]*TestSuite)
+		outputs = make(map[[2]string]*strings.Builder)
+		failed  int
+		lastErr error
+	)
+	write := func(what string, fn func() error) {
+		err := fn()
+		if err == nil {
+			err = pw.Flush()
+		}
+		if err != nil {
+			logger.Errorf("Could not write points for %s: %s", what, err)
+			failed++
+			lastErr = err
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var ev goTestEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil || ev.Action == "" {
+			continue
+		}
+
+		suite, ok := suites[ev.Package]
+		if !ok {
+			suite = &TestSuite{Name: c.scrubber.scrubString(ev.Package)}
+			suites[ev.Package] = suite
+		}
+		key := [2]string{ev.Package, ev.Test}
+
+		switch ev.Action {
+		case "output":
+			if ev.Test != "" {
+				if outputs[key] == nil {
+					outputs[key] = &strings.Builder{}
+				}
+				outputs[key].WriteString(ev.Output)
+			}
+		case "pass", "fail", "skip":
+			if ev.Test == "" {
+				suite.Duration = ev.Elapsed
+				delete(suites, ev.Package)
+				if !c.suiteFilter.match(suite.Name) || len(suite.TestCases) == 0 {
+					continue
+				}
+				c.run.suites++
+				c.run.duration += suite.Duration
+				if c.suiteMeasurement != "" {
+					write(suite.Name, func() error {
+						return c.writeSuiteSummary(pw, suite, nil, ev.Time)
+					})
+				}
+				continue
+			}
+
+			testcase := TestCase{ClassName: ev.Package, Name: ev.Test, Duration: ev.Elapsed}
+			var output string
+			if b := outputs[key]; b != nil {
+				output = b.String()
+				delete(outputs, key)
+			}
+			switch ev.Action {
+			case "fail":
+				testcase.Failure = &Failure{Message: "Failed", Text: output}
+			case "skip":
+				testcase.Skipped = &Skipped{Message: strings.TrimSpace(output)}
+			}
+
+			// The testcase is scrubbed once so the point, the suite
+			// summary, and the run totals all have the scrubbed values.
+			tests := TestSuites{Items: []TestSuite{{TestCases: []TestCase{testcase}}}}
+			c.scrubber.scrub(&tests)
+			testcase = tests.Items[0].TestCases[0]
+
+			suite.Tests++
+			switch ev.Action {
+			case "fail":
+				suite.Failures++
+			case "skip":
+				suite.Skipped++
+			}
+			suite.TestCases = append(suite.TestCases, testcase)
+			if !c.suiteFilter.match(suite.Name) {
+				continue
+			}
+
+			c.run.tests++
+			switch ev.Action {
+			case "fail":
+				c.run.failures++
+			case "skip":
+				c.run.skipped++
+			}
+			// Excluded tests are left out of the failures and durations
+			// of the run like they are left out of the points.
+			if !c.testFilter.match(testcase.Name) {
+				continue
+			}
+			id := testKey{Suite: suite.Name, ClassName: testcase.ClassName, Name: testcase.Name}
+			if ev.Action == "fail" {
+				c.run.failed = append(c.run.failed, id)
+			}
+			if c.recordDurations {
+				c.run.durations = append(c.run.durations, testDuration{key: id, seconds: testcase.Duration})
+			}
+
+			one := &TestSuite{Name: suite.Name, TestCases: []TestCase{testcase}}
+			if c.manifest != nil {
+				c.manifest.add(one, &one.TestCases[0])
+			}
+			if !c.aggregateOnly {
+				write(ev.Package+" "+ev.Test, func() error {
+					return c.writeTestCase(pw, one, &one.TestCases[0], nil, ev.Time)
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &exitCodeError{code: exitParse, err: fmt.Errorf("Could not read from stdin: %s", err)}
+	}
+	if failed > 0 {
+		return &exitCodeError{code: exitPartialWrite, err: fmt.Errorf("Could not write the points for %d tests or packages: %s", failed, lastErr)}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	influxdb "github.com/influxdata/influxdb/client/v2"
+)
+
+// maxSummaryTests is the number of testcases listed in each table of the
+// markdown summary.
+const maxSummaryTests = 10
+
+// testDuration is the duration of a testcase in seconds.
+type testDuration struct {
+	key     testKey
+	seconds float64
+}
+
+// branchHistory holds the recent results of the target branch that the run
+// is compared with in the markdown summary. The testcases are identified by
+// their suite and name since the classname is not always a tag.
+type branchHistory struct {
+	branch    string
+	failed    map[testKey]bool
+	durations map[testKey]float64
+}
+
+// queryBranchHistory reads the testcases that failed and the mean duration
+// of every testcase on the branch during the last 30 days. The measurement
+// is read from the retention policy the points are written to. The status
+// tag is needed to find the failed testcases.
+func queryBranchHistory(client influxdb.Client, database, retentionPolicy, measurement, branch string, durationScale float64) (*branchHistory, error) {
+	h := &branchHistory{
+		branch:    branch,
+		failed:    make(map[testKey]bool),
+		durations: make(map[testKey]float64),
+	}
+	source := qualifiedMeasurement(database, retentionPolicy, measurement)
+	where := `"branch" = ` + quoteString(branch) + ` AND time > now() - 30d`
+	queries := []struct {
+		stmt string
+		fn   func(key testKey, v interface{})
+	}{
+		{
+			stmt: fmt.Sprintf(`SELECT mean("duration") FROM %s WHERE %s GROUP BY "suite_name", "test_name"`, source, where),
+			fn: func(key testKey, v interface{}) {
+				if n, ok := jsonFloat(v); ok {
+					if durationScale != 0 {
+						n /= durationScale
+					}
+					h.durations[key] = n
+				}
+			},
+		},
+		{
+			stmt: fmt.Sprintf(`SELECT count("duration") FROM %s WHERE %s AND "status" = 'failed' GROUP BY "suite_name", "test_name"`, source, where),
+			fn: func(key testKey, v interface{}) {
+				h.failed[key] = true
+			},
+		},
+	}
+	for _, q := range queries {
+		resp, err := client.Query(influxdb.NewQuery(q.stmt, database, ""))
+		if err != nil {
+			return nil, err
+		} else if err := resp.Error(); err != nil {
+			return nil, err
+		}
+		for _, result := range resp.Results {
+			for _, row := range result.Series {
+				key := testKey{Suite: row.Tags["suite_name"], Name: row.Tags["test_name"]}
+				for _, values := range row.Values {
+					if len(values) > 1 {
+						q.fn(key, values[1])
+					}
+				}
+			}
+		}
+	}
+	return h, nil
+}
+
+// jsonFloat returns the number in a value decoded from a query response.
+func jsonFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case interface {
+		Float64() (float64, error)
+	}:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// writeMarkdownSummary writes the totals of the run, the failed testcases,
+// and the slowest testcases as markdown tables. When the history of the
+// target branch is known, failures that did not happen on the branch are
+// marked as new and the durations are compared with the branch.
+func (c *converter) writeMarkdownSummary(w io.Writer, history *branchHistory, queryURL string) error {
+	var buf strings.Builder
+	buf.WriteString("### Test results\n\n")
+	buf.WriteString("| Tests | Failures | Errors | Skipped | Duration |\n")
+	buf.WriteString("| ---: | ---: | ---: | ---: | ---: |\n")
+	fmt.Fprintf(&buf, "| %d | %d | %d | %d | %.3fs |\n", c.run.tests, c.run.failures, c.run.errors, c.run.skipped, c.run.duration)
+
+	if len(c.run.failed) > 0 {
+		buf.WriteString("\n#### Failed tests\n\n")
+		if history != nil {
+			var n int
+			for _, key := range c.run.failed {
+				if !history.failed[testKey{Suite: key.Suite, Name: key.Name}] {
+					n++
+				}
+			}
+			fmt.Fprintf(&buf, "%d of the failures did not happen on `%s` in the last 30 days.\n\n", n, history.branch)
+			buf.WriteString("| Suite | Test | |\n| --- | --- | --- |\n")
+		} else {
+			buf.WriteString("| Suite | Test |\n| --- | --- |\n")
+		}
+		for i, key := range c.run.failed {
+			if i == maxSummaryTests {
+				fmt.Fprintf(&buf, "\n…and %d more\n", len(c.run.failed)-i)
+				break
+			}
+			fmt.Fprintf(&buf, "| %s | %s |", markdownCell(key.Suite), markdownCell(key.Name))
+			if history != nil {
+				if history.failed[testKey{Suite: key.Suite, Name: key.Name}] {
+					fmt.Fprintf(&buf, " also failing on `%s` |", history.branch)
+				} else {
+					buf.WriteString(" **new** |")
+				}
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	if len(c.run.durations) > 0 {
+		slowest := make([]testDuration, len(c.run.durations))
+		copy(slowest, c.run.durations)
+		sort.SliceStable(slowest, func(i, j int) bool {
+			return slowest[i].seconds > slowest[j].seconds
+		})
+		if len(slowest) > maxSummaryTests {
+			slowest = slowest[:maxSummaryTests]
+		}
+
+		buf.WriteString("\n#### Slowest tests\n\n")
+		if history != nil {
+			fmt.Fprintf(&buf, "| Suite | Test | Duration | `%s` |\n| --- | --- | ---: | ---: |\n", history.branch)
+		} else {
+			buf.WriteString("| Suite | Test | Duration |\n| --- | --- | ---: |\n")
+		}
+		for _, d := range slowest {
+			fmt.Fprintf(&buf, "| %s | %s | %.3fs |", markdownCell(d.key.Suite), markdownCell(d.key.Name), d.seconds)
+			if history != nil {
+				if prev, ok := history.durations[testKey{Suite: d.key.Suite, Name: d.key.Name}]; ok && prev > 0 {
+					fmt.Fprintf(&buf, " %.3fs (%+.0f%%) |", prev, (d.seconds-prev)/prev*100)
+				} else {
+					buf.WriteString(" - |")
+				}
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	if queryURL != "" {
+		fmt.Fprintf(&buf, "\n[Query the results in InfluxDB](%s)\n", queryURL)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// markdownCell escapes the characters that would end a table cell.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	s = strings.Replace(s, "\r\n", " ", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
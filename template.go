@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// templateData is the data available to tag and field templates. Suite
+// and Test are never nil; for points that do not belong to a testsuite or
+// testcase they are empty so the template evaluates to an empty value.
+type templateData struct {
+	Suite      *TestSuite
+	Test       *TestCase
+	Properties map[string]string
+	Env        map[string]string
+}
+
+// environ is the environment made available to templates. It is read
+// once since the uploads of serve convert their reports concurrently.
+var (
+	environ     map[string]string
+	environOnce sync.Once
+)
+
+func newTemplateData(testsuite *TestSuite, testcase *TestCase) *templateData {
+	environOnce.Do(func() {
+		environ = make(map[string]string)
+		for _, kv := range os.Environ() {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				environ[kv[:i]] = kv[i+1:]
+			}
+		}
+	})
+
+	if testsuite == nil {
+		testsuite = &TestSuite{}
+	}
+	if testcase == nil {
+		testcase = &TestCase{}
+	}
+	properties := make(map[string]string, len(testsuite.Properties.Items))
+	for _, p := range testsuite.Properties.Items {
+		properties[p.Name] = p.Value
+	}
+	return &templateData{
+		Suite:      testsuite,
+		Test:       testcase,
+		Properties: properties,
+		Env:        environ,
+	}
+}
+
+// parseValueTemplate parses a tag or field value template. It returns nil
+// if the value does not contain any template actions.
+func parseValueTemplate(name, value string) (*template.Template, error) {
+	if !strings.Contains(value, "{{") {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=zero").Parse(value)
+}
+
+func (d *templateData) execute(tmpl *template.Template) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// trendOptions are the options of the trend report.
+type trendOptions struct {
+	*reportOptions
+	suite            string
+	interval         string
+	suiteMeasurement string
+}
+
+func addTrendFlags(fs *pflag.FlagSet) *trendOptions {
+	o := &trendOptions{reportOptions: addReportFlags(fs)}
+	fs.StringVar(&o.suite, "suite", "", "only read the results of this testsuite; all of the testsuites are combined by default")
+	fs.StringVar(&o.interval, "interval", "1d", "length of each period of the trend, such as 6h or 1w")
+	fs.StringVar(&o.suiteMeasurement, "suite-measurement", "junit_suite_results", "measurement of the testsuite summary points")
+	return o
+}
+
+// trendBucket holds the totals of the testsuites in a period of the trend.
+type trendBucket struct {
+	time                             string
+	tests, failures, errors, skipped int
+	duration                         float64
+}
+
+// passRate returns the fraction of the executed testcases that passed and
+// false when every testcase was skipped.
+func (b *trendBucket) passRate() (float64, bool) {
+	return passRate(b.tests, b.failures, b.errors, b.skipped)
+}
+
+// reportTrend shows the pass rate and the mean testsuite duration of each
+// period within the window of the report. It reads the testsuite summary
+// points so the reports must be written with --suite-summaries or
+// --schema v2.
+func reportTrend(args []string) {
+	fs := pflag.NewFlagSet("report trend", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "report trend [options]")
+	o := addTrendFlags(fs)
+	fs.Parse(args)
+	o.validate(fs)
+	if !influxDurationRE.MatchString(o.interval) {
+		logger.Exitf(exitUsage, "Invalid --interval value: %s", o.interval)
+	}
+	client := o.connect()
+	defer client.Close()
+
+	o.measurement = o.suiteMeasurement
+	where := o.where()
+	if o.suite != "" {
+		where += ` AND "suite_name" = ` + quoteString(o.suite)
+	}
+	stmt := fmt.Sprintf(`SELECT sum("tests") AS "tests", sum("failures") AS "failures", sum("errors") AS "errors", sum("skipped") AS "skipped", mean("duration") AS "duration" FROM %s WHERE %s GROUP BY time(%s) fill(none)`, o.source(), where, o.interval)
+	var buckets []*trendBucket
+	err := queryRows(client, o.conn.database, stmt, func(tags map[string]string, values map[string]interface{}) {
+		b := &trendBucket{time: fmt.Sprint(values["time"])}
+		for name, v := range map[string]*int{"tests": &b.tests, "failures": &b.failures, "errors": &b.errors, "skipped": &b.skipped} {
+			if n, ok := jsonFloat(values[name]); ok {
+				*v = int(n)
+			}
+		}
+		b.duration, _ = o.seconds(values["duration"])
+		buckets = append(buckets, b)
+	})
+	if err != nil {
+		logger.Exitf(exitConnection, "Could not query the results: %s", err)
+	}
+	if len(buckets) == 0 {
+		logger.Warnf("No testsuite summaries in %s; write the points with --suite-summaries or --schema v2", o.suiteMeasurement)
+	}
+
+	table := &reportTable{columns: []string{"time", "tests", "failures", "errors", "skipped", "pass_rate", "duration"}}
+	if o.format == "text" {
+		table.columns = append(table.columns, "")
+	}
+	low, high := 1.0, 0.0
+	for _, b := range buckets {
+		if rate, ok := b.passRate(); ok {
+			if rate < low {
+				low = rate
+			}
+			if rate > high {
+				high = rate
+			}
+		}
+	}
+	for _, b := range buckets {
+		var rate interface{}
+		if r, ok := b.passRate(); ok {
+			rate = r
+		}
+		row := []interface{}{b.time, b.tests, b.failures, b.errors, b.skipped, rate, b.duration}
+		if o.format == "text" {
+			row = append(row, trendBar(rate, low, high))
+		}
+		table.add(row...)
+	}
+	o.writeTable(table)
+
+	if o.format == "text" && o.output == "" && len(buckets) > 1 {
+		writeTrendSummary(os.Stdout, buckets[0], buckets[len(buckets)-1])
+	}
+}
+
+// trendBar draws the pass rate as a bar scaled between the lowest and the
+// highest pass rate of the trend so small changes are still visible.
+func trendBar(rate interface{}, low, high float64) string {
+	r, ok := rate.(float64)
+	if !ok {
+		return ""
+	}
+	const width = 20
+	n := width
+	if high > low {
+		n = 1 + int((r-low)/(high-low)*(width-1))
+	}
+	return strings.Repeat("#", n)
+}
+
+// writeTrendSummary writes how the pass rate and the duration changed from
+// the first period to the last.
+func writeTrendSummary(w io.Writer, first, last *trendBucket) {
+	fmt.Fprintln(w)
+	if a, ok := first.passRate(); ok {
+		if b, ok := last.passRate(); ok {
+			fmt.Fprintf(w, "Pass rate: %.1f%% -> %.1f%% (%+.1f points)\n", a*100, b*100, (b-a)*100)
+		}
+	}
+	if first.duration > 0 {
+		fmt.Fprintf(w, "Duration:  %.3fs -> %.3fs (%+.1f%%)\n", first.duration, last.duration, (last.duration/first.duration-1)*100)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// writeAheadLog stores the points of writes that failed in a directory so
+// they can be written once the server is available again. Each write is
+// kept in its own file named after the time it was stored so the writes
+// are replayed in order. A file starts with a json header line followed by
+// the points as line protocol.
+type writeAheadLog struct {
+	dir string
+
+	mu   sync.Mutex
+	last int64
+}
+
+// walHeader is the first line of a write-ahead log file and records where
+// the points are written.
+type walHeader struct {
+	Database        string `json:"database"`
+	RetentionPolicy string `json:"retention_policy"`
+	Precision       string `json:"precision"`
+}
+
+func openWriteAheadLog(dir string) (*writeAheadLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{dir: dir}, nil
+}
+
+// append stores the points of a write. The file is written under a
+// temporary name first so a partially written file is never replayed.
+func (l *writeAheadLog) append(h walHeader, body []byte) error {
+	header, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	id := time.Now().UnixNano()
+	if id <= l.last {
+		id = l.last + 1
+	}
+	l.last = id
+	l.mu.Unlock()
+
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d.wal", id))
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(body)
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// pending returns the paths of the stored writes in the order they were
+// stored.
+func (l *writeAheadLog) pending() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(l.dir, "*.wal"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// replay sends the stored writes in order and removes each one once it has
+// been sent. It stops at the first write that cannot be sent because the
+// server is unavailable and returns the number of writes sent. A write that
+// the server rejects for another reason would never succeed, so it is
+// renamed with the .failed suffix and skipped.
+func (l *writeAheadLog) replay(send func(h walHeader, body []byte) error) (int, error) {
+	paths, err := l.pending()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, path := range paths {
+		h, body, err := readWALFile(path)
+		if err != nil {
+			return n, err
+		}
+		if err := send(h, body); err != nil {
+			if retryable(err) {
+				return n, err
+			}
+			logger.Errorf("Discarding buffered write %s: %s", filepath.Base(path), err)
+			if err := os.Rename(path, path+".failed"); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func readWALFile(path string) (walHeader, []byte, error) {
+	var h walHeader
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return h, nil, err
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return h, nil, fmt.Errorf("%s: missing header", path)
+	}
+	if err := json.Unmarshal(data[:i], &h); err != nil {
+		return h, nil, fmt.Errorf("%s: invalid header: %s", path, err)
+	}
+	return h, data[i+1:], nil
+}
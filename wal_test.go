@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// errs are the errors of sending each write in order. The writes
+		// after the last error are sent.
+		errs    []error
+		sent    int
+		wantErr bool
+		pending []string
+		failed  []string
+	}{
+		{
+			name:    "AllSent",
+			sent:    3,
+			pending: []string{},
+			failed:  []string{},
+		},
+		{
+			name:    "Unavailable",
+			errs:    []error{nil, &httpError{status: http.StatusServiceUnavailable}},
+			sent:    1,
+			wantErr: true,
+			pending: []string{"b", "c"},
+			failed:  []string{},
+		},
+		{
+			name:    "ConnectionRefused",
+			errs:    []error{errors.New("connection refused")},
+			sent:    0,
+			wantErr: true,
+			pending: []string{"a", "b", "c"},
+			failed:  []string{},
+		},
+		{
+			name:    "Rejected",
+			errs:    []error{nil, &httpError{status: http.StatusBadRequest}},
+			sent:    2,
+			pending: []string{},
+			failed:  []string{"b"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "influx-junit-wal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			l, err := openWriteAheadLog(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := walHeader{Database: "junit", RetentionPolicy: "autogen", Precision: "s"}
+			for _, body := range []string{"a", "b", "c"} {
+				if err := l.append(h, []byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var bodies []string
+			n, err := l.replay(func(got walHeader, body []byte) error {
+				if got != h {
+					t.Errorf("got header %+v, want %+v", got, h)
+				}
+				i := len(bodies)
+				bodies = append(bodies, string(body))
+				if i < len(tt.errs) {
+					return tt.errs[i]
+				}
+				return nil
+			})
+			if tt.wantErr != (err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if n != tt.sent {
+				t.Errorf("sent %d writes, want %d", n, tt.sent)
+			}
+			if want := []string{"a", "b", "c"}[:len(bodies)]; !reflect.DeepEqual(bodies, want) {
+				t.Errorf("sent %q out of order", bodies)
+			}
+
+			if got := walBodies(t, dir, "*.wal"); !reflect.DeepEqual(got, tt.pending) {
+				t.Errorf("pending writes %q, want %q", got, tt.pending)
+			}
+			if got := walBodies(t, dir, "*.wal.failed"); !reflect.DeepEqual(got, tt.failed) {
+				t.Errorf("failed writes %q, want %q", got, tt.failed)
+			}
+		})
+	}
+}
+
+// walBodies returns the bodies of the files in the directory that match
+// the pattern.
+func walBodies(t *testing.T, dir, pattern string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := []string{}
+	for _, path := range paths {
+		_, body, err := readWALFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(body))
+	}
+	return bodies
+}
+
+func TestReadWALFile(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "Valid", data: "{\"database\":\"junit\"}\ncpu value=1\n"},
+		{name: "EmptyBody", data: "{}\n"},
+		{name: "MissingHeader", data: "{}", wantErr: true},
+		{name: "InvalidHeader", data: "cpu value=1\n", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "influx-junit-wal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tt.data)
+			f.Close()
+
+			if _, _, err := readWALFile(f.Name()); tt.wantErr != (err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// watchOptions are the options of the watch command in addition to the
+// ingest options.
+type watchOptions struct {
+	pattern      string
+	pollInterval time.Duration
+	markerSuffix string
+	exitFile     string
+}
+
+func addWatchFlags(fs *pflag.FlagSet) *watchOptions {
+	o := &watchOptions{}
+	fs.StringVar(&o.pattern, "pattern", "*.xml", "glob matching the reports within the directory")
+	fs.DurationVar(&o.pollInterval, "poll-interval", 2*time.Second, "how often to look for new reports")
+	fs.StringVar(&o.markerSuffix, "marker-suffix", ".ingested", "suffix of the marker file written next to each report once its points are written")
+	fs.StringVar(&o.exitFile, "exit-file", "done", "write the remaining reports and exit once this file exists, relative to the directory")
+	return o
+}
+
+// watch writes the points for the reports that appear in a directory until
+// the exit file is created, such as by the test container of a kubernetes
+// job sharing the directory with this one as a sidecar. A report is written
+// once it has stopped changing between two polls and a marker file is
+// written next to it so it is not written again, even after a restart. On
+// SIGINT or SIGTERM, the remaining reports are written before exiting.
+func watch(args []string) {
+	fs := pflag.NewFlagSet("watch", pflag.ExitOnError)
+	fs.Usage = commandUsage(fs, "watch [options] <dir>")
+	o := newIngestOptions(fs)
+	wo := addWatchFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		logger.Exitf(exitUsage, "Must specify the directory to watch")
+	}
+	dir := fs.Arg(0)
+	if fi, err := os.Stat(dir); err != nil {
+		logger.Exitf(exitUsage, "Unable to watch %s: %s", dir, err)
+	} else if !fi.IsDir() {
+		logger.Exitf(exitUsage, "Unable to watch %s: not a directory", dir)
+	}
+	if *o.dedup != "" {
+		logger.Exitf(exitUsage, "The --dedup option cannot be used with watch")
+	}
+	if _, err := filepath.Match(wo.pattern, ""); err != nil {
+		logger.Exitf(exitUsage, "Invalid --pattern value: %s", err)
+	}
+	exitFile := wo.exitFile
+	if !filepath.IsAbs(exitFile) {
+		exitFile = filepath.Join(dir, exitFile)
+	}
+
+	c, precision := newIngestConverter(fs, o, nil)
+	pw, _, _ := newIngestWriter(o, c, precision)
+	w := &reportWatcher{
+		c:            c,
+		pw:           pw,
+		pattern:      filepath.Join(dir, wo.pattern),
+		markerSuffix: wo.markerSuffix,
+		seen:         make(map[string]os.FileInfo),
+		failed:       make(map[string]bool),
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(wo.pollInterval)
+	defer ticker.Stop()
+
+	logger.Info("Watching for reports", "dir", dir, "pattern", wo.pattern)
+	for done := false; !done; {
+		// The exit file is checked before the scan so the reports that
+		// were written before it are all included in the last scan.
+		if _, err := os.Stat(exitFile); err == nil {
+			logger.Info("Found exit file", "file", exitFile)
+			done = true
+		}
+		if !done {
+			select {
+			case <-ticker.C:
+			case s := <-sig:
+				logger.Info("Received signal, writing the remaining reports", "signal", s)
+				done = true
+			}
+		}
+		if err := w.scan(done); err != nil {
+			logger.Fatalf("Unable to list the reports: %s", err)
+		}
+		if w.seriesLimit != nil {
+			break
+		}
+	}
+
+	if *o.runSummary && w.seriesLimit == nil {
+		if err := c.writeRunSummary(pw, *o.runMeasurement, time.Now()); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := pw.Flush(); err != nil {
+			logger.Exitf(exitPartialWrite, "Could not write points: %s", err)
+		}
+	}
+	if closer, ok := pw.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Fatalf("Could not close output: %s", err)
+		}
+	}
+
+	if w.seriesLimit != nil {
+		logger.Exitf(exitSeriesLimit, "%s", w.seriesLimit)
+	}
+	if failed := w.parseErrs + w.writeErrs; failed > 0 {
+		code := exitParse
+		if w.writeErrs > 0 {
+			code = exitPartialWrite
+			if w.written == 0 {
+				code = exitConnection
+			}
+		}
+		logger.Exitf(code, "Could not write %d of %d reports", failed, failed+w.written)
+	}
+	checkGates(c)
+}
+
+// reportWatcher writes the points for the reports matching a pattern that
+// do not have a marker file yet.
+type reportWatcher struct {
+	c            *converter
+	pw           PointsWriter
+	pattern      string
+	markerSuffix string
+
+	// seen holds the file info of each report from the previous scan
+	// and failed the reports that could not be written, which are not
+	// tried again.
+	seen   map[string]os.FileInfo
+	failed map[string]bool
+
+	buf                           bufferedPointsWriter
+	written, parseErrs, writeErrs int
+
+	// seriesLimit is the error of the report that crossed --max-series.
+	// The watch stops once it is set.
+	seriesLimit error
+}
+
+// scan writes the reports that have not changed since the previous scan.
+// When final is set, every report is written without waiting for it to
+// stop changing.
+func (w *reportWatcher) scan(final bool) error {
+	paths, err := filepath.Glob(w.pattern)
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if w.failed[path] {
+			continue
+		}
+		if _, err := os.Stat(path + w.markerSuffix); err == nil {
+			delete(w.seen, path)
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		prev, ok := w.seen[path]
+		w.seen[path] = fi
+		if !final && (!ok || prev.Size() != fi.Size() || !prev.ModTime().Equal(fi.ModTime())) {
+			continue
+		}
+
+		delete(w.seen, path)
+		err = ingestFile(w.c, w.pw, &w.buf, path, time.Now())
+		// Only the totals are used once the watch ends, so the testcases
+		// of each report are not kept.
+		w.c.run.dropTestcases()
+		if err != nil {
+			if exitCode(err) == exitSeriesLimit {
+				w.seriesLimit = err
+				return nil
+			}
+			logger.Errorf("%s", err)
+			w.failed[path] = true
+			if exitCode(err) == exitParse {
+				w.parseErrs++
+			} else {
+				w.writeErrs++
+			}
+			continue
+		}
+		w.written++
+		if err := ioutil.WriteFile(path+w.markerSuffix, nil, 0644); err != nil {
+			logger.Warnf("Could not write the marker for %s: %s", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// webhookConfig holds the settings of the ci webhooks of the serve command.
+// The webhook of a provider is only enabled when its secret is set.
+type webhookConfig struct {
+	githubSecret string
+	githubToken  string
+	gitlabSecret string
+	gitlabToken  string
+	gitlabURL    string
+
+	// artifactPattern matches the base name of the reports within the
+	// artifacts.
+	artifactPattern string
+}
+
+// githubWorkflowRunEvent holds the fields of a github workflow_run webhook
+// that are used to find the reports of the run.
+type githubWorkflowRunEvent struct {
+	Action      string `json:"action"`
+	WorkflowRun struct {
+		ID         int64  `json:"id"`
+		Name       string `json:"name"`
+		RunNumber  int64  `json:"run_number"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+	} `json:"workflow_run"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// gitlabPipelineEvent holds the fields of a gitlab pipeline webhook that
+// are used to find the reports of the pipeline.
+type gitlabPipelineEvent struct {
+	ObjectAttributes struct {
+		ID     int64  `json:"id"`
+		Ref    string `json:"ref"`
+		SHA    string `json:"sha"`
+		Status string `json:"status"`
+	} `json:"object_attributes"`
+	Project struct {
+		ID                int64  `json:"id"`
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	Builds []struct {
+		ID            int64 `json:"id"`
+		ArtifactsFile struct {
+			Filename string `json:"filename"`
+		} `json:"artifacts_file"`
+	} `json:"builds"`
+}
+
+// githubWebhook handles POST /webhooks/github. When a workflow run has
+// completed, the reports in the artifacts of the run are written for the
+// project named after the repository. The artifacts are downloaded after
+// responding since github only waits a few seconds for the response.
+func (s *server) githubWebhook(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(s.webhooks.githubSecret))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !secureCompare(r.Header.Get("X-Hub-Signature-256"), want) {
+		writeError(w, http.StatusUnauthorized, "Invalid signature")
+		return
+	}
+
+	if r.Header.Get("X-GitHub-Event") != "workflow_run" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+	var event githubWorkflowRunEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unable to decode event: %s", err))
+		return
+	}
+	if event.Action != "completed" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		project := event.Repository.FullName
+		if err := s.ingestGitHubRun(&event); err != nil {
+			logger.Errorf("Could not write the reports of %s run %d: %s", project, event.WorkflowRun.ID, err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+func (s *server) ingestGitHubRun(event *githubWorkflowRunEvent) error {
+	api := newGitHubAPI(s.client, s.webhooks.githubToken)
+	artifacts, err := api.runArtifacts(event.Repository.FullName, event.WorkflowRun.ID)
+	if err != nil {
+		return err
+	}
+
+	var reports []*TestSuites
+	for _, artifact := range artifacts {
+		req, err := api.artifactRequest(artifact)
+		if err != nil {
+			return err
+		}
+		found, err := s.downloadArtifactReports(req)
+		if err != nil {
+			return fmt.Errorf("artifact %s: %s", artifact.Name, err)
+		}
+		reports = append(reports, found...)
+	}
+
+	return s.writeWebhookReports(event.Repository.FullName, reports, map[string]string{
+		"branch":       event.WorkflowRun.HeadBranch,
+		"commit":       event.WorkflowRun.HeadSHA,
+		"workflow":     event.WorkflowRun.Name,
+		"build_number": fmt.Sprint(event.WorkflowRun.RunNumber),
+	})
+}
+
+// githubArtifact is an artifact of a github workflow run.
+type githubArtifact struct {
+	Name               string `json:"name"`
+	Expired            bool   `json:"expired"`
+	ArchiveDownloadURL string `json:"archive_download_url"`
+}
+
+// runArtifacts lists the artifacts of a workflow run that have not expired.
+func (api *githubAPI) runArtifacts(repo string, runID int64) ([]githubArtifact, error) {
+	var list struct {
+		Artifacts []githubArtifact `json:"artifacts"`
+	}
+	if err := api.do("GET", fmt.Sprintf("/repos/%s/actions/runs/%d/artifacts?per_page=100", repo, runID), nil, &list); err != nil {
+		return nil, err
+	}
+	artifacts := list.Artifacts[:0]
+	for _, artifact := range list.Artifacts {
+		if !artifact.Expired {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
+
+// artifactRequest returns the request that downloads the zip archive of
+// the artifact.
+func (api *githubAPI) artifactRequest(artifact githubArtifact) (*http.Request, error) {
+	req, err := http.NewRequest("GET", artifact.ArchiveDownloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+api.token)
+	return req, nil
+}
+
+// gitlabWebhook handles POST /webhooks/gitlab. When a pipeline has
+// finished, the reports in the artifacts of its jobs are written for the
+// project named after the path of the gitlab project.
+func (s *server) gitlabWebhook(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	if !secureCompare(r.Header.Get("X-Gitlab-Token"), s.webhooks.gitlabSecret) {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	if r.Header.Get("X-Gitlab-Event") != "Pipeline Hook" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+	var event gitlabPipelineEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unable to decode event: %s", err))
+		return
+	}
+	if status := event.ObjectAttributes.Status; status != "success" && status != "failed" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		project := event.Project.PathWithNamespace
+		if err := s.ingestGitLabPipeline(&event); err != nil {
+			logger.Errorf("Could not write the reports of %s pipeline %d: %s", project, event.ObjectAttributes.ID, err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+func (s *server) ingestGitLabPipeline(event *gitlabPipelineEvent) error {
+	var reports []*TestSuites
+	for _, build := range event.Builds {
+		if build.ArtifactsFile.Filename == "" {
+			continue
+		}
+		u := fmt.Sprintf("%s/api/v4/projects/%d/jobs/%d/artifacts", strings.TrimSuffix(s.webhooks.gitlabURL, "/"), event.Project.ID, build.ID)
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("PRIVATE-TOKEN", s.webhooks.gitlabToken)
+		found, err := s.downloadArtifactReports(req)
+		if err != nil {
+			return fmt.Errorf("job %d: %s", build.ID, err)
+		}
+		reports = append(reports, found...)
+	}
+
+	return s.writeWebhookReports(event.Project.PathWithNamespace, reports, map[string]string{
+		"branch":       event.ObjectAttributes.Ref,
+		"commit":       event.ObjectAttributes.SHA,
+		"build_number": fmt.Sprint(event.ObjectAttributes.ID),
+	})
+}
+
+// readWebhook reads the body of a webhook request. It writes the error
+// response and returns false when the body cannot be read.
+func (s *server) readWebhook(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil, false
+	}
+	if s.maxUpload > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// writeWebhookReports writes the reports found in the artifacts of a run.
+func (s *server) writeWebhookReports(project string, reports []*TestSuites, tags map[string]string) error {
+	if len(reports) == 0 {
+		logger.Info("No reports in the artifacts", "project", project)
+		return nil
+	}
+	_, _, err := s.writeReports(project, reports, tags)
+	return err
+}
+
+// downloadArtifactReports downloads a zip archive of artifacts and decodes
+// the files matching the artifact pattern. The archive and the reports
+// decompressed from it may not be larger than the upload limit.
+func (s *server) downloadArtifactReports(req *http.Request) ([]*TestSuites, error) {
+	var reports []*TestSuites
+	budget := newUploadBudget(s.maxUpload)
+	err := readArtifacts(s.client, req, s.webhooks.artifactPattern, s.maxUpload, func(name string, r io.Reader) error {
+		tests, err := decodeUpload(budget.reader(r), budget)
+		if err != nil {
+			return fmt.Errorf("Unable to decode report %s: %s", name, err)
+		}
+		reports = append(reports, tests)
+		return nil
+	})
+	return reports, err
+}
+
+// readArtifacts downloads a zip archive of artifacts and calls fn with each
+// file whose base name matches the pattern. The archive may not be larger
+// than limit bytes when the limit is positive.
+func readArtifacts(client *http.Client, req *http.Request, pattern string, limit int64, fn func(name string, r io.Reader) error) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("download returned %s", resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	} else if limit > 0 && int64(len(data)) > limit {
+		return fmt.Errorf("archive is larger than %d bytes", limit)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if ok, _ := path.Match(pattern, path.Base(f.Name)); !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// parseYAML parses the configuration files. Mappings are returned as
+// map[string]interface{}, sequences as []interface{}, and scalars as the
+// strings they were written as, so true and 1.0 are kept as text until the
+// option using them parses them. Empty values, null, and ~ are returned as
+// nil.
+func parseYAML(data []byte) (interface{}, error) {
+	var v yamlValue
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v.v, nil
+}
+
+// yamlValue decodes a yaml value into the types returned by parseYAML.
+type yamlValue struct {
+	v interface{}
+}
+
+func (y *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	switch raw.(type) {
+	case nil:
+		y.v = nil
+	case map[interface{}]interface{}:
+		var m map[string]yamlValue
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		values := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			values[k] = v.v
+		}
+		y.v = values
+	case []interface{}:
+		var l []yamlValue
+		if err := unmarshal(&l); err != nil {
+			return err
+		}
+		values := make([]interface{}, len(l))
+		for i, v := range l {
+			values[i] = v.v
+		}
+		y.v = values
+	default:
+		// Decoding a scalar into a string keeps the text it was
+		// written as rather than the value it resolves to.
+		var s string
+		if err := unmarshal(&s); err != nil {
+			return err
+		}
+		y.v = s
+	}
+	return nil
+}
+
+// yamlString returns the value as a string. Only scalars may be converted.
+func yamlString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("expected a string")
+	}
+}
+
+// yamlStrings returns the value as a list of strings. A single string is
+// returned as a list with one element.
+func yamlStrings(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := yamlString(item)
+			if err != nil {
+				return nil, err
+			}
+			ss = append(ss, s)
+		}
+		return ss, nil
+	default:
+		return nil, fmt.Errorf("expected a list of strings")
+	}
+}
+
+// yamlMap returns the value as a mapping.
+func yamlMap(v interface{}) (map[string]interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expected a mapping")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+			data: "# only a comment\n",
+			want: nil,
+		},
+		{
+			name: "Scalars",
+			data: "database: junit\nport: 8086\nenabled: true\nratio: 1.0\nquoted: 'it''s # not a comment' # a comment\n",
+			want: map[string]interface{}{
+				"database": "junit",
+				"port":     "8086",
+				"enabled":  "true",
+				"ratio":    "1.0",
+				"quoted":   "it's # not a comment",
+			},
+		},
+		{
+			name: "Null",
+			data: "a:\nb: ~\nc: null\n",
+			want: map[string]interface{}{"a": nil, "b": nil, "c": nil},
+		},
+		{
+			name: "Sequences",
+			data: "tag:\n  - a=1\n  - b=2\nexclude-suite: [flaky, \"slow, really\"]\n",
+			want: map[string]interface{}{
+				"tag":           []interface{}{"a=1", "b=2"},
+				"exclude-suite": []interface{}{"flaky", "slow, really"},
+			},
+		},
+		{
+			name: "NestedMappings",
+			data: "projects:\n  api:\n    token: secret\n    tags: {team: core}\n",
+			want: map[string]interface{}{
+				"projects": map[string]interface{}{
+					"api": map[string]interface{}{
+						"token": "secret",
+						"tags":  map[string]interface{}{"team": "core"},
+					},
+				},
+			},
+		},
+		{
+			name: "LiteralBlock",
+			data: "template: |\n  line one\n    indented\n  line three\nnext: x\n",
+			want: map[string]interface{}{
+				"template": "line one\n  indented\nline three\n",
+				"next":     "x",
+			},
+		},
+		{
+			name: "FoldedBlock",
+			data: "message: >\n  folded\n  text\n\n  paragraph\n",
+			want: map[string]interface{}{"message": "folded text\nparagraph\n"},
+		},
+		{
+			name: "NumericKey",
+			data: "1: one\n",
+			want: map[string]interface{}{"1": "one"},
+		},
+		{
+			name:    "TabIndentation",
+			data:    "tag:\n\t- a=1\n",
+			wantErr: true,
+		},
+		{
+			name:    "UnclosedFlow",
+			data:    "tag: [a, b\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected value:\n got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLStrings(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		v       interface{}
+		want    []string
+		wantErr bool
+	}{
+		{name: "Nil", v: nil, want: nil},
+		{name: "String", v: "a", want: []string{"a"}},
+		{name: "List", v: []interface{}{"a", "b"}, want: []string{"a", "b"}},
+		{name: "NestedList", v: []interface{}{[]interface{}{"a"}}, wantErr: true},
+		{name: "Mapping", v: map[string]interface{}{"a": "b"}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := yamlStrings(tt.v)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}